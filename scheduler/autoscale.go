@@ -0,0 +1,178 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsSource 微服务负载指标来源
+type MetricsSource interface {
+	// Utilization 返回各应用中微服务所有副本的平均资源利用率
+	Utilization() (map[appId]map[msId]float32, error)
+}
+
+// FileMetrics 从文件读取负载指标，每行为“应用 id 微服务 id 利用率”，空行和以 # 开头的行被忽略
+type FileMetrics struct {
+	path string
+}
+
+func NewFileMetrics(path string) *FileMetrics {
+	return &FileMetrics{path: path}
+}
+
+func (f *FileMetrics) Utilization() (map[appId]map[msId]float32, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ret := make(map[appId]map[msId]float32)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expect \"app ms utilization\", got %q", f.path, line, text)
+		}
+		u, err := strconv.ParseFloat(fields[2], 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", f.path, line, err)
+		}
+		aid := appId(fields[0])
+		if ret[aid] == nil {
+			ret[aid] = make(map[msId]float32)
+		}
+		ret[aid][msId(fields[1])] = float32(u)
+	}
+	return ret, scanner.Err()
+}
+
+//
+// AutoscalePolicy 水平扩缩容策略：期望副本数 = ceil(当前副本数 * 利用率 / 目标利用率)，限制在 [minReplicas, maxReplicas] 之间
+//
+type AutoscalePolicy struct {
+	source      MetricsSource
+	target      float32       // target utilization of the replicas
+	tolerance   float32       // no scaling while utilization/target is within 1 ± tolerance
+	minReplicas int           // lower bound of the replica count
+	maxReplicas int           // upper bound of the replica count
+	interval    time.Duration // interval between two evaluations in the scheduling loop
+	last        time.Time     // last evaluation
+}
+
+func NewAutoscalePolicy(source MetricsSource, target float32, minReplicas, maxReplicas int) *AutoscalePolicy {
+	return &AutoscalePolicy{
+		source:      source,
+		target:      target,
+		tolerance:   AutoscaleTolerance,
+		minReplicas: minReplicas,
+		maxReplicas: maxReplicas,
+		interval:    AutoscaleInterval,
+	}
+}
+
+// desired 按利用率计算期望副本数
+func (p *AutoscalePolicy) desired(cur int, util float32) int {
+	ratio := util / p.target
+	if math.Abs(float64(ratio-1)) <= float64(p.tolerance) {
+		return cur
+	}
+	n := int(math.Ceil(float64(float32(cur) * ratio)))
+	if n < p.minReplicas {
+		n = p.minReplicas
+	}
+	if n > p.maxReplicas {
+		n = p.maxReplicas
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// SetAutoscale 设置水平扩缩容策略，调度循环按策略的间隔定期执行，policy 为 nil 时关闭
+func (m *MOTAS) SetAutoscale(policy *AutoscalePolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.autoscale = policy
+}
+
+// autoscaleDue 判断是否到了执行扩缩容策略的时间
+func (m *MOTAS) autoscaleDue() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.autoscale != nil && time.Since(m.autoscale.last) >= m.autoscale.interval
+}
+
+// Autoscale 按扩缩容策略读取负载指标，将已放置应用中利用率偏离目标的微服务调整到期望副本数，
+// 返回第一个调整失败的错误，其余微服务仍会继续调整
+func (m *MOTAS) Autoscale() error {
+	m.mu.Lock()
+	policy := m.autoscale
+	if policy != nil {
+		policy.last = time.Now()
+	}
+	m.mu.Unlock()
+	if policy == nil {
+		return nil
+	}
+	utils, err := policy.source.Utilization()
+	if err != nil {
+		return err
+	}
+
+	type decision struct {
+		app appId
+		ms  msId
+		cur int
+		n   int
+	}
+	decisions := make([]decision, 0)
+	m.mu.RLock()
+	for aid, ms := range utils {
+		app, ok := m.app[aid]
+		if !ok || !app.placed {
+			continue
+		}
+		for mid, util := range ms {
+			if _, ok := app.ms[mid]; !ok || app.ms[mid].fixed() {
+				continue
+			}
+			cur := len(app.replicasOf(mid))
+			if n := policy.desired(cur, util); n != cur {
+				decisions = append(decisions, decision{app: aid, ms: mid, cur: cur, n: n})
+			}
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(decisions, func(i, j int) bool {
+		if decisions[i].app != decisions[j].app {
+			return decisions[i].app < decisions[j].app
+		}
+		return decisions[i].ms < decisions[j].ms
+	})
+
+	var first error
+	for _, d := range decisions {
+		DLogINFO("📈 autoscale ms %s/%s: %d -> %d replicas", d.app, d.ms, d.cur, d.n)
+		if err := m.ScaleMicroservice(d.app, d.ms, d.n); err != nil {
+			DLogINFO("autoscale ms %s/%s fails: %v", d.app, d.ms, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoscaleDesired(t *testing.T) {
+	p := NewAutoscalePolicy(nil, 0.5, 1, 4)
+	cases := []struct {
+		cur  int
+		util float32
+		want int
+	}{
+		{1, 0.52, 1}, // within tolerance
+		{1, 0.9, 2},
+		{2, 0.2, 1},
+		{2, 5, 4}, // capped by maxReplicas
+	}
+	for _, c := range cases {
+		if got := p.desired(c.cur, c.util); got != c.want {
+			t.Fatalf("desired(%d, %.2f) = %d, expect %d", c.cur, c.util, got, c.want)
+		}
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	path := filepath.Join(t.TempDir(), "metrics")
+	metrics := "# app ms utilization\ntest0 B 0.9\ntest0 C 0.5\nunknown X 0.9\n"
+	if err := os.WriteFile(path, []byte(metrics), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mts.SetAutoscale(NewAutoscalePolicy(NewFileMetrics(path), 0.5, 1, 3))
+	if !mts.autoscaleDue() {
+		t.Fatalf("expect the first evaluation to be due")
+	}
+	if err := mts.Autoscale(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("replicas of B:", len(app.replicasOf("B")), "C:", len(app.replicasOf("C")))
+	if len(app.replicasOf("B")) != 2 || len(app.replicasOf("C")) != 1 || mts.autoscaleDue() {
+		t.Fatalf("expect B to be scaled out by the policy")
+	}
+	checkCommitted(t, mts)
+
+	if err := os.WriteFile(path, []byte("test0 B\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mts.Autoscale(); err == nil {
+		t.Fatalf("expect a malformed metrics file to be reported")
+	}
+}
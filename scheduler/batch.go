@@ -0,0 +1,208 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// crossCall 跨应用调用在两端放置节点之间预留的链路带宽
+type crossCall struct {
+	umId  msId
+	dmApp appId
+	dmId  msId
+	from  nodeId
+	to    nodeId
+	trans float32
+}
+
+// batchMsId 成员应用的微服务在批量应用中的 id
+func batchMsId(aid appId, mid msId) msId {
+	return msId(string(aid) + "/" + string(mid))
+}
+
+// AddBatch 准入一组应用并作为一个整体放入调度队列，这组应用要么全部放置，要么都不放置。
+// 成员之间的跨应用调用计入通信开销，使互相通信的应用一起划分，而不是按优先级逐个放置
+func (m *MOTAS) AddBatch(apps []*Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(apps) == 0 {
+		return errors.New("empty batch")
+	}
+	seen := make(map[appId]bool, len(m.app)+len(apps)) // 已登记的应用以及等待调度的批量应用的成员
+	for aid, app := range m.app {
+		seen[aid] = true
+		for _, member := range app.members {
+			seen[member.id] = true
+		}
+	}
+	for _, app := range apps {
+		if seen[app.id] {
+			return fmt.Errorf("app %s already exists", app.id)
+		}
+		seen[app.id] = true
+	}
+	for _, app := range apps {
+		app.readmit()
+		delete(m.rejected, app.id)
+		app.expandReplicas()
+	}
+	batch := newBatch(apps)
+	demand := batch.byTenant((*Service).demand)
+	if err := m.checkTenants(demand); err != nil {
+		if m.quotaPolicy == QuotaReject {
+			DLogINFO("🚫 batch(id=%s) is rejected: %v", batch.id, err)
+			return err
+		}
+		m.app[batch.id] = batch
+		m.hold(batch, demand, err)
+		return nil
+	}
+	m.app[batch.id] = batch
+	DLogINFO("batch(id=%s) enters the scheduling queue", batch.id)
+	m.scheduleQ.push(batch)
+	return nil
+}
+
+// newBatch 将一组应用组合为一个批量应用：成员的微服务、调用关系、约束和入口流量按“应用 id/微服务 id”重新命名，
+// 成员之间的跨应用调用成为批量应用内部的调用关系，批量应用的优先级取成员中的最高者
+func newBatch(apps []*Service) *Service {
+	ids := make([]string, 0, len(apps))
+	inBatch := make(map[appId]*Service, len(apps))
+	batch := &Service{
+		rootId:   batchMsId(apps[0].id, apps[0].rootId),
+		ms:       make(map[msId]*Microservice),
+		dep:      make(map[msId][]*Dependence),
+		reDep:    make(map[msId][]*Dependence),
+		priority: apps[0].priority,
+		tenant:   apps[0].tenant,
+		members:  apps,
+	}
+	for _, app := range apps {
+		ids = append(ids, string(app.id))
+		inBatch[app.id] = app
+		if app.priority > batch.priority {
+			batch.priority = app.priority
+		}
+	}
+	batch.id = appId("batch(" + strings.Join(ids, ",") + ")")
+
+	addDep := func(dep *Dependence) {
+		batch.dep[dep.umId] = append(batch.dep[dep.umId], dep)
+		batch.reDep[dep.dmId] = append(batch.reDep[dep.dmId], dep)
+	}
+	for _, app := range apps {
+		for mid, ms := range app.ms {
+			bms := *ms
+			bms.id, bms.origin = batchMsId(app.id, mid), batchMsId(app.id, ms.originId())
+			batch.ms[bms.id] = &bms
+		}
+		for _, deps := range app.dep {
+			for _, dep := range deps {
+				addDep(&Dependence{umId: batchMsId(app.id, dep.umId), dmId: batchMsId(app.id, dep.dmId), trans: dep.trans, calls: dep.calls})
+			}
+		}
+		for _, deps := range app.remoteDep {
+			for _, dep := range deps {
+				peer, ok := inBatch[dep.dmApp]
+				if !ok { // 对端应用不在本批中
+					continue
+				}
+				dms := peer.replicasOf(dep.dmId)
+				for _, dm := range dms { // 流量在下游副本之间均分
+					addDep(&Dependence{umId: batchMsId(app.id, dep.umId), dmId: batchMsId(peer.id, dm.id),
+						trans: dep.trans / float32(len(dms)), calls: dep.calls})
+				}
+			}
+		}
+		for _, con := range app.constraints {
+			bcon := *con
+			bcon.a, bcon.b = batchMsId(app.id, con.a), batchMsId(app.id, con.b)
+			batch.constraints = append(batch.constraints, &bcon)
+		}
+		for _, in := range app.ingress {
+			root := in.root
+			if root == "" {
+				root = app.rootId
+			}
+			batch.ingress = append(batch.ingress, &Ingress{gateway: in.gateway, trans: in.trans, root: batchMsId(app.id, root)})
+		}
+	}
+	return batch
+}
+
+// memberPlacement 返回成员应用的微服务在批量应用中的预放置节点
+func (s *Service) memberPlacement(member *Service) func(msId) nodeId {
+	return func(mid msId) nodeId {
+		return s.nextPlacement(batchMsId(member.id, mid))
+	}
+}
+
+// spread 将批量应用的（预）放置位置写回各成员应用
+func (s *Service) spread() {
+	for _, member := range s.members {
+		for mid, ms := range member.ms {
+			bms := s.ms[batchMsId(member.id, mid)]
+			ms.placeNode, ms.nextPlaceNode = bms.placeNode, bms.nextPlaceNode
+		}
+	}
+}
+
+// unpack 批量应用放置后，成员作为独立的应用登记并计入各自租户的用量，批量应用本身不再登记。
+// 成员之间的跨应用调用记录在上游应用中，任一端应用被移除或驱逐时回收其链路带宽，调用者需持有 m.mu
+func (m *MOTAS) unpack(batch *Service) {
+	batch.spread()
+	inBatch := make(map[appId]*Service, len(batch.members))
+	for _, member := range batch.members {
+		inBatch[member.id] = member
+	}
+	for _, member := range batch.members {
+		for _, deps := range member.remoteDep {
+			for _, dep := range deps {
+				peer, ok := inBatch[dep.dmApp]
+				if !ok {
+					continue
+				}
+				dms := peer.replicasOf(dep.dmId)
+				for _, dm := range dms {
+					member.crossCalls = append(member.crossCalls, crossCall{
+						umId:  dep.umId,
+						dmApp: peer.id,
+						dmId:  dm.id,
+						from:  member.ms[dep.umId].placeNode,
+						to:    dm.placeNode,
+						trans: dep.trans / float32(len(dms)),
+					})
+				}
+			}
+		}
+		for mid, ms := range member.ms { // 调用批量之外已放置应用的流量
+			for _, call := range batch.remoteCallsOf(batchMsId(member.id, mid), ms.placeNode) {
+				call.umId = mid
+				member.crossCalls = append(member.crossCalls, call)
+			}
+		}
+		member.placed = true
+		member.enqueuedAt = time.Time{}
+		m.app[member.id] = member
+		m.reserve(member)
+	}
+	batch.remote = nil
+	delete(m.app, batch.id)
+	DLogINFO("batch(id=%s) is unpacked into %d apps", batch.id, len(batch.members))
+}
+
+// dropCrossCalls 丢弃与应用相关的跨应用调用记录，其链路带宽已随应用一起回收，调用者需持有 m.mu
+func (m *MOTAS) dropCrossCalls(aid appId) {
+	for _, app := range m.app {
+		kept := app.crossCalls[:0]
+		for _, call := range app.crossCalls {
+			if app.id != aid && call.dmApp != aid {
+				kept = append(kept, call)
+			}
+		}
+		app.crossCalls = kept
+	}
+}
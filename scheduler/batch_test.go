@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newTestPair 构造前端应用 fe（A -> B）和后端应用 be（C -> D），fe 的 B 调用 be 的 C
+func newTestPair(resReq map[ResourceType]Resource, bandReq, crossReq float32) (*Service, *Service) {
+	newApp := func(aid appId, um, dm msId) *Service {
+		dep := &Dependence{umId: um, dmId: dm, trans: bandReq}
+		return &Service{
+			id:     aid,
+			rootId: um,
+			ms: map[msId]*Microservice{
+				um: {id: um, resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced},
+				dm: {id: dm, resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced},
+			},
+			dep:   map[msId][]*Dependence{um: {dep}},
+			reDep: map[msId][]*Dependence{dm: {dep}},
+		}
+	}
+	fe, be := newApp("fe", "A", "B"), newApp("be", "C", "D")
+	fe.remoteDep = map[msId][]*Dependence{"B": {{umId: "B", dmId: "C", trans: crossReq, dmApp: "be"}}}
+	return fe, be
+}
+
+func TestBatch(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	mts := newTestMOTAS(cluster)
+	fe, be := newTestPair(resReq, BandReq, 2*BandReq)
+	be.ms["C"].replicas = 2
+	if err := mts.AddBatch([]*Service{fe, be}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mts.AddBatch([]*Service{fe}); err == nil {
+		t.Fatalf("expect an app in a queued batch to be rejected")
+	}
+
+	if !mts.scheduleOne() {
+		t.Fatalf("expect the batch to be placed")
+	}
+	for _, app := range []*Service{fe, be} {
+		for mid, ms := range app.ms {
+			fmt.Printf("%s/%s -> %s\n", app.id, mid, ms.placeNode)
+			if ms.placeNode == NotPlaced {
+				t.Fatalf("expect %s/%s to be placed", app.id, mid)
+			}
+		}
+		if !app.placed || mts.app[app.id] != app {
+			t.Fatalf("expect app %s to be registered as placed", app.id)
+		}
+	}
+	if len(mts.app) != 2 {
+		t.Fatalf("expect the batch itself not to stay registered, got %d apps", len(mts.app))
+	}
+	fmt.Println("cross calls:", fe.crossCalls)
+	if len(fe.crossCalls) != 2 || fe.crossCalls[0].trans != BandReq {
+		t.Fatalf("expect the call to be split across the replicas of C, got %v", fe.crossCalls)
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.RemoveApp("be"); err != nil {
+		t.Fatal(err)
+	}
+	if len(fe.crossCalls) != 0 {
+		t.Fatalf("expect the cross-app calls to be dropped with the callee")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestBatchAllOrNothing(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	mts := newTestMOTAS(cluster)
+	fe, be := newTestPair(resReq, BandReq, BandReq)
+	be.ms["D"].resReq = map[ResourceType]Resource{ResCPU: {ResCPU, 2 * resCPU}, ResMem: {ResMem, 5 * MB}}
+	if err := mts.AddBatch([]*Service{fe, be}); err != nil {
+		t.Fatal(err)
+	}
+
+	if mts.scheduleOne() {
+		t.Fatalf("expect the batch to fail")
+	}
+	if fe.placed || be.placed || len(mts.backoffQ) != 1 {
+		t.Fatalf("expect no member to be placed and the batch to back off")
+	}
+	for nid, node := range cluster.nodes {
+		if node.alloc[ResCPU].value != 0 {
+			t.Fatalf("expect nothing to be reserved on node %s", nid)
+		}
+	}
+	checkCommitted(t, mts)
+}
+
+func TestBatchQuota(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	mts := newTestMOTAS(cluster)
+	mts.SetQuota("t1", map[ResourceType]float32{ResCPU: 3}, nil)
+	fe, be := newTestPair(resReq, BandReq, BandReq)
+	fe.tenant, be.tenant = "t0", "t1"
+
+	err := mts.AddBatch([]*Service{fe, be})
+	fmt.Println("add batch:", err)
+	if _, ok := err.(*QuotaError); !ok || len(mts.app) != 0 {
+		t.Fatalf("expect the batch to be rejected by the quota of a member's tenant, got %v", err)
+	}
+}
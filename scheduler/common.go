@@ -1,5 +1,7 @@
 package scheduler
 
+import "time"
+
 type appId string
 
 type msId string
@@ -19,13 +21,55 @@ const (
 	TB
 )
 
+const (
+	SaturationPenalty SaturationPolicy = iota // oversubscribed links get a large inter penalty
+	SaturationReject                          // paths that would oversubscribe a link are rejected
+)
+
+const (
+	QuotaReject QuotaPolicy = iota // AddTask rejects apps that would go over the tenant quota
+	QuotaHold                      // apps that would go over the tenant quota are held until usage drops
+)
+
+const (
+	SpreadNode SpreadLevel = iota // replicas spread across nodes
+	SpreadZone                    // replicas spread across zones (fault domains)
+)
+
+const (
+	Affinity     ConstraintKind = iota // microservices must (or should) share a node or a zone
+	AntiAffinity                       // microservices must (or should) not share a node or a zone
+)
+
+const (
+	NoSchedule       TaintEffect = iota // microservices that do not tolerate the taint are never placed on the node
+	PreferNoSchedule                    // microservices that do not tolerate the taint get a score penalty on the node
+)
+
 const (
 	PrevNull         = "-1" // 在一条路径上，当前节点没有前驱节点
 	NotPlaced nodeId = "-1" // 微服务没有放置在任何工作节点上
 
 	AppQIniLen = 20
 
+	PreemptSearchSize = 3 // max size of the victim sets that are searched exhaustively for a minimum one
+
+	MaxAttempts = 5                      // max scheduling attempts before an app becomes unschedulable
+	BackoffBase = 100 * time.Millisecond // backoff after the first failed attempt
+	BackoffMax  = 30 * time.Second       // upper bound of the backoff
+
+	AutoscaleTolerance float32 = 0.1              // no scaling while utilization/target is within 1 ± tolerance
+	AutoscaleInterval          = 30 * time.Second // interval between two evaluations of the autoscale policy
+	RescheduleInterval         = 5 * time.Minute  // interval between two evaluations of the reschedule policy
+
 	AlphaC float32 = 0.33 // argument of the score function for cost
 	AlphaI float32 = 0.33 // argument of the score function for inter
 	AlphaF float32 = 0.33 // argument of the score function for frag
+	AlphaL float32 = 0.33 // argument of the score function for latency
+
+	MaxCongestion            float32 = 100 // upper bound of the link congestion factor
+	DefaultSaturationPenalty float32 = 1e4 // inter penalty base of an oversubscribed link
+	TaintPenalty             float32 = 10  // score penalty of each untolerated PreferNoSchedule taint
+
+	DefragEpsilon float32 = 1e-3 // min decrease of the cluster fragmentation for a move of the defragmentation planner
 )
@@ -1,6 +1,9 @@
 package scheduler
 
-import "math"
+import (
+	"math"
+	"testing"
+)
 
 var (
 	DefaultResType = []ResourceType{ResCPU, ResMem}
@@ -59,86 +62,148 @@ func newTestService(resReq map[ResourceType]Resource, bandReq float32) *Service
 		},
 		dep: map[msId][]*Dependence{
 			"A": {
-				{"A", "B", bandReq},
-				{"A", "C", bandReq},
+				{umId: "A", dmId: "B", trans: bandReq},
+				{umId: "A", dmId: "C", trans: bandReq},
 			},
 			"B": {
-				{"B", "D", bandReq},
-				{"B", "E", bandReq},
+				{umId: "B", dmId: "D", trans: bandReq},
+				{umId: "B", dmId: "E", trans: bandReq},
 			},
 			"C": {
-				{"C", "D", bandReq},
-				{"C", "F", bandReq},
+				{umId: "C", dmId: "D", trans: bandReq},
+				{umId: "C", dmId: "F", trans: bandReq},
 			},
 		},
 		reDep: map[msId][]*Dependence{
 			"B": {
-				{"A", "B", bandReq},
+				{umId: "A", dmId: "B", trans: bandReq},
 			},
 			"C": {
-				{"A", "C", bandReq},
+				{umId: "A", dmId: "C", trans: bandReq},
 			},
 			"D": {
-				{"B", "D", bandReq},
-				{"C", "D", bandReq},
+				{umId: "B", dmId: "D", trans: bandReq},
+				{umId: "C", dmId: "D", trans: bandReq},
 			},
 			"E": {
-				{"B", "E", bandReq},
+				{umId: "B", dmId: "E", trans: bandReq},
 			},
 			"F": {
-				{"C", "F", bandReq},
+				{umId: "C", dmId: "F", trans: bandReq},
 			},
 		},
 		priority: 5,
 	}
 }
 
+// newTestMOTAS 创建不运行调度循环的 MOTAS，便于单独测试各个步骤
+func newTestMOTAS(cluster *Cluster, apps ...*Service) *MOTAS {
+	mts := newMOTAS(cluster)
+	for _, app := range apps {
+		mts.app[app.id] = app
+	}
+	return mts
+}
+
+// placeApp 调度并放置应用
+func placeApp(t *testing.T, mts *MOTAS, aid appId) {
+	ms2node, err := mts.schedule(aid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(aid, ms2node)
+}
+
+// checkCommitted 检查集群已分配资源和链路带宽与已放置应用的占用一致
+func checkCommitted(t *testing.T, mts *MOTAS) {
+	alloc := make(map[nodeId]float32)
+	band := make(map[*Link]float32)
+	for _, app := range mts.app {
+		if !app.placed {
+			continue
+		}
+		for _, ms := range app.ms {
+			if !ms.external {
+				alloc[ms.placeNode] += ms.resReq[ResCPU].value
+			}
+		}
+		for _, deps := range app.dep {
+			for _, dep := range deps {
+				from, to := app.ms[dep.umId].placeNode, app.ms[dep.dmId].placeNode
+				if link, ok := mts.cluster.links[from][to]; ok {
+					band[link] += dep.trans
+				}
+				if link, ok := mts.cluster.links[to][from]; ok && from != to {
+					band[link] += dep.trans
+				}
+			}
+		}
+		for _, call := range app.crossCalls {
+			if link, ok := mts.cluster.links[call.from][call.to]; ok {
+				band[link] += call.trans
+			}
+			if link, ok := mts.cluster.links[call.to][call.from]; ok && call.from != call.to {
+				band[link] += call.trans
+			}
+		}
+	}
+	for nid, node := range mts.cluster.nodes {
+		if !approxEqual(node.alloc[ResCPU].value, alloc[nid]) {
+			t.Fatalf("node %s: cpu alloc %.2f, expect %.2f", nid, node.alloc[ResCPU].value, alloc[nid])
+		}
+	}
+	for _, links := range mts.cluster.links {
+		for _, link := range links {
+			if !approxEqual(link.bandAlloc, band[link]) {
+				t.Fatalf("link %s -> %s: band alloc %.2f, expect %.2f", link.from, link.to, link.bandAlloc, band[link])
+			}
+		}
+	}
+}
+
+func approxEqual(a, b float32) bool {
+	d := a - b
+	return d < 1e-3 && d > -1e-3
+}
+
 func newTestCluster(resType []ResourceType, resCPU, resMem, band float32) *Cluster {
 	return &Cluster{
 		nodes: map[nodeId]*Node{
 			"node0": {
-				id:          "node0",
-				resType:     resType,
-				capa:        map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
-				alloc:       map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				nextAlloc:   map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				args:        map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
-				minGama:     math.MaxFloat32,
-				nextMinGama: math.MaxFloat32,
-				threshold:   0.8,
+				id:        "node0",
+				resType:   resType,
+				capa:      map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
+				alloc:     map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
+				args:      map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
+				minGama:   math.MaxFloat32,
+				threshold: 0.8,
 			},
 			"node1": {
-				id:          "node1",
-				resType:     resType,
-				capa:        map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
-				alloc:       map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				nextAlloc:   map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				args:        map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
-				minGama:     math.MaxFloat32,
-				nextMinGama: math.MaxFloat32,
-				threshold:   0.8,
+				id:        "node1",
+				resType:   resType,
+				capa:      map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
+				alloc:     map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
+				args:      map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
+				minGama:   math.MaxFloat32,
+				threshold: 0.8,
 			},
 			"node2": {
-				id:          "node2",
-				resType:     resType,
-				capa:        map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
-				alloc:       map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				nextAlloc:   map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				args:        map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
-				minGama:     math.MaxFloat32,
-				nextMinGama: math.MaxFloat32,
-				threshold:   0.8,
+				id:        "node2",
+				resType:   resType,
+				capa:      map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
+				alloc:     map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
+				args:      map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
+				minGama:   math.MaxFloat32,
+				threshold: 0.8,
 			},
 			"node3": {
-				id:          "node3",
-				resType:     resType,
-				capa:        map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
-				alloc:       map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				nextAlloc:   map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
-				args:        map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
-				minGama:     math.MaxFloat32,
-				nextMinGama: math.MaxFloat32,
-				threshold:   0.8,
+				id:        "node3",
+				resType:   resType,
+				capa:      map[ResourceType]*Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, resMem}},
+				alloc:     map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
+				args:      map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
+				minGama:   math.MaxFloat32,
+				threshold: 0.8,
 			},
 		},
 		links: map[nodeId]map[nodeId]*Link{
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+)
+
+// attempt 一次调度尝试的结果，映射在 version 版本的集群快照上完成，预分配记录在应用的事务中
+type attempt struct {
+	app     *Service
+	gen     uint64 // generation of the app when it was mapped
+	version uint64
+	ms2node map[msId]nodeId
+	victims []appId
+	states  []*victimState // placement of the victims when they were released in the txn
+	err     error
+}
+
+// SetWorkers 设置并发映射的应用数，n <= 0 时取 1
+func (m *MOTAS) SetWorkers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n <= 0 {
+		n = 1
+	}
+	m.workers = n
+}
+
+// Conflicts 返回与其间提交的应用发生冲突而重试的调度尝试次数
+func (m *MOTAS) Conflicts() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.conflicts
+}
+
+// scheduleOne 从调度队列中取出一个应用进行调度，调度失败时返回 false
+func (m *MOTAS) scheduleOne() bool {
+	return m.scheduleBatch(1)
+}
+
+// scheduleBatch 从调度队列中取出至多 n 个应用，在同一集群快照上并发映射，再逐个检查冲突并提交，
+// 有应用调度失败时返回 false
+func (m *MOTAS) scheduleBatch(n int) bool {
+	m.mu.Lock()
+	apps := make([]*Service, 0, n)
+	for len(apps) < n && !m.scheduleQ.empty() {
+		if app := m.scheduleQ.pop(); !app.removed {
+			m.app[app.id] = app
+			apps = append(apps, app)
+		}
+	}
+	m.mu.Unlock()
+	if len(apps) == 0 {
+		return true
+	}
+
+	attempts := m.mapApps(apps)
+
+	// 提交阶段串行执行
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for _, a := range attempts {
+		if !m.finish(a) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// mapApps 在同一集群快照上并发映射应用，映射阶段只读集群已提交状态，预分配记录在各自的事务中。
+// 出队后、映射前被移除的应用不再映射，其调度尝试为 nil
+func (m *MOTAS) mapApps(apps []*Service) []*attempt {
+	attempts := make([]*attempt, len(apps))
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		if app.removed || m.app[app.id] != app {
+			DLogINFO("app(id=%s) was removed before being mapped", app.id)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, app *Service) {
+			defer wg.Done()
+			DLogINFO("⏰ app(id=%s) is being scheduled", app.id)
+			attempts[i] = m.tryApp(app)
+		}(i, app)
+	}
+	wg.Wait()
+	return attempts
+}
+
+// tryApp 对应用进行一次调度尝试，资源或链路带宽不足时尝试抢占低优先级应用，调用者需持有 m.mu（读锁即可）
+func (m *MOTAS) tryApp(app *Service) *attempt {
+	a := &attempt{app: app, gen: app.gen, version: m.version}
+	a.ms2node, a.err = m.schedule(app.id)
+	if a.err != nil {
+		a.victims, a.ms2node, a.err = m.preempt(app.id)
+		for _, vid := range a.victims {
+			a.states = append(a.states, m.victimStateOf(vid))
+		}
+	}
+	return a
+}
+
+// validate 快照版本过期时检查调度尝试是否与其间提交的应用冲突：驱逐对象已移动、调整资源、被更新或不再放置，
+// 调用的其他应用已移动或不再放置，或预分配超出容量
+func (m *MOTAS) validate(a *attempt) error {
+	if a.version == m.version {
+		return nil
+	}
+	for i, vid := range a.victims { // 事务中按映射时的位置回收驱逐对象的资源和链路带宽
+		if !a.states[i].same(m.victimStateOf(vid)) {
+			return fmt.Errorf("conflict: victim %s has changed or is no longer placed", vid)
+		}
+	}
+	for _, calls := range a.app.remote {
+		for _, call := range calls {
+			if peer, ok := m.app[call.dmApp]; !ok || !peer.placed || peer.ms[call.dmId].placeNode != call.to {
+				return fmt.Errorf("conflict: callee %s/%s has moved or is no longer placed", call.dmApp, call.dmId)
+			}
+		}
+	}
+	return a.app.tx.validate()
+}
+
+// finish 提交一次调度尝试（a 为 nil 时没有需要提交的尝试），冲突时在当前状态上重试该应用，调度失败时返回 false，调用者需持有 m.mu
+func (m *MOTAS) finish(a *attempt) bool {
+	if a == nil { // 应用在映射前被移除，没有调度尝试
+		return true
+	}
+	app := a.app
+	if app.removed || a.gen != app.gen { // 映射后应用被移除（可能又被重新添加）
+		app.rollbackPlaceStat()
+		return true
+	}
+	if a.err != nil { // 没能得到一个有效的映射结果（资源不足、路径无效或链路饱和），退避后重试或移入不可调度队列
+		m.retryLater(app, a.err)
+		return false
+	}
+	if err := m.validate(a); err != nil {
+		m.conflicts++
+		DLogINFO("🔁 app(id=%s) retries: %v", app.id, err)
+		app.rollbackPlaceStat()
+		return m.finish(m.tryApp(app))
+	}
+	app.spread() // 批量应用的成员按各自的租户检查配额
+	usage := app.byTenant(func(s *Service) *resUsage { return s.usageOf(m.cluster, true) })
+	if err := m.checkTenants(usage, a.victims...); err != nil { // 链路带宽在放置后才能确定，超出配额时按配额策略拒绝或暂缓调度
+		app.rollbackPlaceStat() // 放弃本次调度尝试的事务
+		if m.quotaPolicy == QuotaReject {
+			m.reject(app, err)
+			return false
+		}
+		m.hold(app, usage, err)
+		return true
+	}
+	m.doPlacement(app.id, a.ms2node) // 根据映射关系将微服务放置到对应的工作节点上
+	if len(a.victims) > 0 {
+		m.evict(app.id, a.victims)
+	}
+	DLogINFO("✅ app(id=%s) was scheduled successfully", app.id)
+	DLogINFO("the mapping of microservices and worker nodes:")
+	for mid, nid := range a.ms2node {
+		DLogINFO("- ms:%s -> node:%s", mid, nid)
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestConcurrentSchedule(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 8*brand)
+	mts := newTestMOTAS(cluster)
+	mts.SetWorkers(8)
+	small := map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}
+	for i := 0; i < 8; i++ {
+		app := newTestService(small, BandReq/4)
+		app.id = appId(fmt.Sprintf("app%d", i))
+		if err := mts.AddTask(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mts.scheduleBatch(mts.workers)
+	placed := 0
+	for _, app := range mts.app {
+		if app.placed {
+			placed++
+		}
+	}
+	fmt.Println("placed:", placed, "conflicts:", mts.Conflicts(), "backoff:", len(mts.backoffQ))
+	if placed == 0 || placed+len(mts.backoffQ) != 8 {
+		t.Fatalf("expect every app to be placed or backed off, placed=%d", placed)
+	}
+	if mts.Conflicts() == 0 {
+		t.Fatalf("expect apps mapped on the same snapshot to conflict")
+	}
+	for nid, node := range cluster.nodes {
+		for typ, capa := range node.capa {
+			if node.alloc[typ].value > capa.value {
+				t.Fatalf("node %s is overcommitted: %v alloc/cap=%.2f/%.2f", nid, typ, node.alloc[typ].value, capa.value)
+			}
+		}
+	}
+	checkCommitted(t, mts)
+}
+
+func TestConcurrentRemovedApp(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	a := mts.tryApp(app)
+	app.removed = true
+	if !mts.finish(a) || app.placed || app.tx != nil {
+		t.Fatalf("expect an app removed while being mapped to be dropped")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestConcurrentRemovedBeforeMapping(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster)
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	popped := mts.scheduleQ.pop()
+	if err := mts.RemoveApp(app.id); err != nil { // 出队后、映射前移除
+		t.Fatal(err)
+	}
+	attempts := mts.mapApps([]*Service{popped})
+	if attempts[0] != nil || !mts.finish(attempts[0]) || app.placed {
+		t.Fatalf("expect an app removed before being mapped to be skipped")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestReaddRemovedApp(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster)
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	if err := mts.RemoveApp(app.id); err != nil {
+		t.Fatal(err)
+	}
+	if !mts.scheduleQ.empty() {
+		t.Fatalf("expect a removed app to leave the scheduling queue")
+	}
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	mts.scheduleOne()
+	if !app.placed || !mts.scheduleQ.empty() {
+		t.Fatalf("expect a re-added app to be placed")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestReaddWhileMapping(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster)
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	attempts := mts.mapApps([]*Service{mts.scheduleQ.pop()})
+	if err := mts.RemoveApp(app.id); err != nil { // 映射后、提交前移除并重新添加
+		t.Fatal(err)
+	}
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	if !mts.finish(attempts[0]) || app.placed || mts.scheduleQ.len() != 1 {
+		t.Fatalf("expect the attempt mapped before the removal to be dropped")
+	}
+	mts.scheduleOne()
+	if !app.placed {
+		t.Fatalf("expect the re-added app to be placed")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestVictimMovedWhileMapping(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	low1 := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 3}, ResMem: {ResMem, 25 * MB}}, BandReq)
+	low1.id, low1.priority = "low1", 2
+	low2 := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	low2.id, low2.priority = "low2", 1
+	high := newTestService(resReq, BandReq)
+	high.id, high.priority = "high", 10
+	mts := newTestMOTAS(cluster, low1, low2, high)
+	placeApp(t, mts, low1.id)
+	placeApp(t, mts, low2.id)
+
+	a := mts.tryApp(high)
+	if a.err != nil || len(a.victims) == 0 {
+		t.Fatalf("expect app high to preempt, got %v %v", a.victims, a.err)
+	}
+	// 映射后、提交前迁移一个驱逐对象的微服务
+	victim := mts.app[a.victims[0]]
+	moved := false
+	for _, mid := range []msId{"A", "B", "C", "D", "E", "F"} {
+		from := victim.ms[mid].placeNode
+		for _, nid := range []nodeId{"node0", "node1", "node2", "node3"} {
+			if nid == from {
+				continue
+			}
+			if err := mts.ApplyPlan(&MigrationPlan{moves: []*Migration{{app: victim.id, ms: mid, from: from, to: nid}}}); err == nil {
+				fmt.Printf("moved %s/%s: %s -> %s\n", victim.id, mid, from, nid)
+				moved = true
+				break
+			}
+		}
+		if moved {
+			break
+		}
+	}
+	if !moved {
+		t.Fatalf("expect a ms of victim %s to be movable", victim.id)
+	}
+	mts.finish(a)
+	if mts.Conflicts() != 1 {
+		t.Fatalf("expect the moved victim to be detected as a conflict")
+	}
+	checkCommitted(t, mts)
+}
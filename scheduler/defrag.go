@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DefragPlan 碎片整理计划：迁移计划以及执行前后预期的集群资源碎片，freed 为迁移后腾空的节点
+type DefragPlan struct {
+	*MigrationPlan
+	before float32
+	after  float32
+	freed  []nodeId
+}
+
+func (d *DefragPlan) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "frag: %.4f -> %.4f, freed nodes: %v\n", d.before, d.after, d.freed)
+	sb.WriteString(d.MigrationPlan.String())
+	return sb.String()
+}
+
+// PlanDefrag 生成至多 maxMoves 次迁移的碎片整理计划：先腾空迁移次数最少的节点，把其上的微服务迁移到其他已使用的节点上，
+// 再贪心地选择使集群资源碎片（getFrag）下降最多的迁移。目标节点需满足资源容量和资源均衡阈值，迁移后不超出链路带宽容量且满足应用级约束。
+// 计划不修改放置结果，由 ApplyPlan 执行
+func (m *MOTAS) PlanDefrag(maxMoves int) (*DefragPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if maxMoves < 1 {
+		return nil, fmt.Errorf("defragmentation needs at least 1 move, got %d", maxMoves)
+	}
+	var (
+		c       = m.cluster.begin()
+		plan    = &MigrationPlan{moves: make([]*Migration, 0, maxMoves)}
+		moved   = make(map[*Microservice]bool)
+		drained = make(map[nodeId]bool)
+		ret     = &DefragPlan{MigrationPlan: plan, before: c.fragWith(NotPlaced, nil), freed: make([]nodeId, 0)}
+	)
+	defer func() { // 计划不修改放置结果
+		for ms := range moved {
+			ms.nextPlaceNode = ms.placeNode
+		}
+	}()
+	move := func(c *Cluster, app *Service, ms *Microservice, to nodeId) {
+		plan.moves = append(plan.moves, &Migration{app: app.id, ms: ms.id, from: ms.nextPlaceNode, to: to})
+		m.detach(c, app, ms.id)
+		m.attach(c, app, ms.id, to)
+		moved[ms] = true
+	}
+
+	// 腾空节点：只迁移到其他已使用的节点上，节点上有固定位置的微服务时不腾空
+	byNode := m.msByNode(c)
+	nodes := sortedNodes(byNode)
+	sort.SliceStable(nodes, func(i, j int) bool { return len(byNode[nodes[i]]) < len(byNode[nodes[j]]) })
+	for _, nid := range nodes {
+		mss := m.msByNode(c)[nid] // 已计划的迁移可能把微服务迁移到该节点上
+		if len(drained)+1 >= len(byNode) || plan.Len()+len(mss) > maxMoves {
+			continue
+		}
+		exclude := map[nodeId]bool{nid: true}
+		for id := range c.nodes {
+			if _, ok := byNode[id]; !ok || drained[id] {
+				exclude[id] = true
+			}
+		}
+		var (
+			v    = c.begin()
+			n    = plan.Len()
+			done = true
+		)
+		for _, p := range mss {
+			if p.ms.fixed() {
+				done = false
+				break
+			}
+			to, _ := m.defragMove(v, p.app, p.ms.id, exclude)
+			if to == NotPlaced {
+				done = false
+				break
+			}
+			move(v, p.app, p.ms, to)
+		}
+		if !done { // 放弃腾空该节点，此前腾空其他节点时已迁移的微服务仍计为已迁移
+			for _, mv := range plan.moves[n:] {
+				m.app[mv.app].ms[mv.ms].nextPlaceNode = mv.from
+			}
+			plan.moves = plan.moves[:n]
+			moved = make(map[*Microservice]bool)
+			for _, mv := range plan.moves {
+				moved[m.app[mv.app].ms[mv.ms]] = true
+			}
+			continue
+		}
+		v.commit()
+		drained[nid] = true
+		ret.freed = append(ret.freed, nid)
+		DLogINFO("defrag plans to free node %s with %d moves", nid, plan.Len()-n)
+	}
+
+	// 降低资源碎片：每个微服务至多迁移一次，不迁移到已腾空的节点上
+	for plan.Len() < maxMoves {
+		var (
+			cur      = c.fragWith(NotPlaced, nil)
+			best     *placedMs
+			bestTo   nodeId
+			bestFrag = cur - DefragEpsilon
+		)
+		for _, nid := range sortedNodes(byNode) {
+			for _, p := range byNode[nid] {
+				if p.ms.fixed() || moved[p.ms] {
+					continue
+				}
+				if to, frag := m.defragMove(c, p.app, p.ms.id, drained); to != NotPlaced && frag < bestFrag {
+					best, bestTo, bestFrag = p, to, frag
+				}
+			}
+		}
+		if best == nil {
+			break
+		}
+		DLogINFO("defrag plans to migrate ms %s/%s from node %s to node %s, frag %.4f -> %.4f",
+			best.app.id, best.ms.id, best.ms.nextPlaceNode, bestTo, cur, bestFrag)
+		move(c, best.app, best.ms, bestTo)
+	}
+	ret.after = c.fragWith(NotPlaced, nil)
+	return ret, nil
+}
+
+// placedMs 已放置应用中的一个微服务
+type placedMs struct {
+	app *Service
+	ms  *Microservice
+}
+
+// msByNode 按预放置节点汇总已放置应用中占用节点资源的微服务，节点上的微服务按应用 id 和微服务 id 排序
+func (m *MOTAS) msByNode(c *Cluster) map[nodeId][]*placedMs {
+	ret := make(map[nodeId][]*placedMs)
+	for _, app := range m.app {
+		if !app.placed {
+			continue
+		}
+		for _, ms := range app.ms {
+			if _, ok := c.nodes[ms.nextPlaceNode]; ok && !ms.external {
+				ret[ms.nextPlaceNode] = append(ret[ms.nextPlaceNode], &placedMs{app: app, ms: ms})
+			}
+		}
+	}
+	for _, mss := range ret {
+		sort.Slice(mss, func(i, j int) bool {
+			if mss[i].app.id != mss[j].app.id {
+				return mss[i].app.id < mss[j].app.id
+			}
+			return mss[i].ms.id < mss[j].ms.id
+		})
+	}
+	return ret
+}
+
+// sortedNodes 按 id 排序的节点
+func sortedNodes(byNode map[nodeId][]*placedMs) []nodeId {
+	ret := make([]nodeId, 0, len(byNode))
+	for nid := range byNode {
+		ret = append(ret, nid)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// defragMove 在事务视图 c 中为已放置的微服务 mid 选出迁移后集群资源碎片最小的节点，不考虑 exclude 中的节点。
+// 目标节点需满足资源容量和资源均衡阈值，迁移后不超出链路带宽容量且满足应用级约束，没有满足条件的节点时返回 NotPlaced
+func (m *MOTAS) defragMove(c *Cluster, app *Service, mid msId, exclude map[nodeId]bool) (nodeId, float32) {
+	var (
+		ms   = app.ms[mid]
+		from = ms.nextPlaceNode
+		v    = c.begin()
+	)
+	defer func() { ms.nextPlaceNode = from }()
+	m.detach(v, app, mid)
+
+	nodes, _ := v.filterBalanceNode(app, mid)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	var (
+		to      = NotPlaced
+		minFrag = float32(math.MaxFloat32)
+	)
+	for _, nid := range nodes {
+		if nid == from || exclude[nid] {
+			continue
+		}
+		frag := v.fragWith(nid, ms.resReq)
+		if frag >= minFrag {
+			continue
+		}
+		w := v.begin()
+		m.attach(w, app, mid, nid)
+		ok := w.tx.validate() == nil && m.validatePlacement(w, app.id) == nil
+		ms.nextPlaceNode = from
+		if ok {
+			to, minFrag = nid, frag
+		}
+	}
+	return to, minFrag
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDefrag(t *testing.T) {
+	cluster, app, mts := newTestDrift(t)
+
+	d, err := mts.PlanDefrag(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Print(d)
+	if len(d.freed) == 0 || d.Len() == 0 || d.Len() > 10 || d.after > d.before {
+		t.Fatalf("expect the plan to free nodes without raising the fragmentation")
+	}
+	for _, mv := range d.moves {
+		if ms := app.ms[mv.ms]; ms.placeNode != mv.from || ms.nextPlaceNode != mv.from {
+			t.Fatalf("expect ms %s to stay on node %s before the plan is applied", mv.ms, mv.from)
+		}
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ApplyPlan(d.MigrationPlan); err != nil {
+		t.Fatal(err)
+	}
+	for _, nid := range d.freed {
+		if alloc := cluster.nodes[nid].alloc[ResCPU].value; alloc != 0 {
+			t.Fatalf("expect node %s to be freed, cpu alloc=%.2f", nid, alloc)
+		}
+	}
+	if frag := cluster.fragWith(NotPlaced, nil); !approxEqual(frag, d.after) {
+		t.Fatalf("expect the fragmentation to be %.4f after the plan, got %.4f", d.after, frag)
+	}
+	checkCommitted(t, mts)
+}
+
+func TestDefragBounded(t *testing.T) {
+	cluster, _, mts := newTestDrift(t)
+
+	d, err := mts.PlanDefrag(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Print(d)
+	if d.Len() != 1 || len(d.freed) != 1 {
+		t.Fatalf("expect a single move that frees a node, got %d moves", d.Len())
+	}
+
+	for _, node := range cluster.nodes { // 任何节点都无法满足资源均衡阈值
+		node.threshold = -1
+	}
+	d, err = mts.PlanDefrag(10)
+	if err != nil || d.Len() != 0 || d.after != d.before {
+		t.Fatalf("expect no move to pass the node threshold, got %v, err=%v", d, err)
+	}
+	if _, err := mts.PlanDefrag(0); err == nil {
+		t.Fatalf("expect a plan without moves to be rejected")
+	}
+}
+
+func TestDefragFrag(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	cpuHeavy := map[ResourceType]Resource{ResCPU: {ResCPU, 2}, ResMem: {ResMem, 5 * MB}}
+	memHeavy := map[ResourceType]Resource{ResCPU: {ResCPU, 0.5}, ResMem: {ResMem, 35 * MB}}
+	for _, mid := range []msId{"A", "C", "E"} {
+		app.ms[mid].resReq, app.ms[mid].pinNode = cpuHeavy, "node0"
+	}
+	for _, mid := range []msId{"B", "D", "F"} {
+		app.ms[mid].resReq, app.ms[mid].pinNode = memHeavy, "node1"
+	}
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+	for _, ms := range app.ms {
+		ms.pinNode = ""
+	}
+
+	d, err := mts.PlanDefrag(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Print(d)
+	if d.Len() == 0 || d.Len() > 3 || d.after >= d.before {
+		t.Fatalf("expect the plan to lower the fragmentation of the imbalanced nodes")
+	}
+	if err := mts.ApplyPlan(d.MigrationPlan); err != nil {
+		t.Fatal(err)
+	}
+	if frag := cluster.fragWith(NotPlaced, nil); !approxEqual(frag, d.after) {
+		t.Fatalf("expect the fragmentation to be %.4f after the plan, got %.4f", d.after, frag)
+	}
+	checkCommitted(t, mts)
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+// totalCapacity 集群节点资源总量和链路带宽总量，双向链路按一条计算
+func (c *Cluster) totalCapacity() *resUsage {
+	total := newResUsage()
+	for _, node := range c.top().nodes {
+		for rt, r := range node.capa {
+			total.res[rt] += r.value
+		}
+	}
+	for from, links := range c.links {
+		for to, link := range links {
+			if _, ok := c.links[to][from]; ok && to < from { // 反向链路已计入
+				continue
+			}
+			total.band += link.bandCap
+		}
+	}
+	return total
+}
+
+// dominantShare 租户已占用资源中占集群总量比例最大的份额（主导份额），链路带宽作为一种资源参与计算，调用者需持有 m.mu
+func (m *MOTAS) dominantShare(tenant string, total *resUsage) float32 {
+	u, ok := m.usage[tenant]
+	if !ok {
+		return 0
+	}
+	var share float32 = 0
+	for rt, v := range u.res {
+		if total.res[rt] > 0 && v/total.res[rt] > share {
+			share = v / total.res[rt]
+		}
+	}
+	if total.band > 0 && u.band/total.band > share {
+		share = u.band / total.band
+	}
+	return share
+}
+
+// pickDRF 按主导资源公平（DRF）选择加权主导份额最小的租户，作为调度队列的 tenantPicker 在出队时读取各租户用量 m.usage，调用者需持有 m.mu
+func (m *MOTAS) pickDRF(active []string) string {
+	total := m.cluster.totalCapacity()
+	ret, minShare := active[0], m.dominantShare(active[0], total)/m.scheduleQ.weightOf(active[0])
+	for _, tenant := range active[1:] {
+		if share := m.dominantShare(tenant, total) / m.scheduleQ.weightOf(tenant); share < minShare {
+			ret, minShare = tenant, share
+		}
+	}
+	return ret
+}
+
+// SetDRF 按主导资源公平在租户之间选择下一个被调度的应用，weights 为各租户权重，缺省为 1。
+// 选择租户时读取各租户用量，调度队列此后只能在持有 m.mu 时出队
+func (m *MOTAS) SetDRF(weights map[string]float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scheduleQ.setFairness(true, weights, m.pickDRF)
+}
+
+// DominantShare 返回租户当前的主导份额
+func (m *MOTAS) DominantShare(tenant string) float32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.dominantShare(tenant, m.cluster.totalCapacity())
+}
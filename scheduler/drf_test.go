@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDominantResourceFairness(t *testing.T) {
+	cluster := newTestCluster(resType, 4*resCPU, 4*resMem, 8*brand)
+	cpuReq := map[ResourceType]Resource{ResCPU: {ResCPU, 2}, ResMem: {ResMem, 1 * MB}}
+	netReq := map[ResourceType]Resource{ResCPU: {ResCPU, 0.1}, ResMem: {ResMem, 1 * MB}}
+	mts := newTestMOTAS(cluster)
+	mts.SetDRF(nil)
+	for i := 0; i < 3; i++ {
+		cpuApp := newTestService(cpuReq, 0)
+		cpuApp.id, cpuApp.tenant, cpuApp.priority = appId(fmt.Sprintf("cpu%d", i)), "cpu", 10
+		netApp := newTestService(netReq, 2*BandReq)
+		netApp.id, netApp.tenant = appId(fmt.Sprintf("net%d", i)), "net"
+		for _, app := range []*Service{cpuApp, netApp} {
+			if err := mts.AddTask(app); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// cpu 的主导资源为 CPU（每个应用 12/128），net 的主导资源为链路带宽，每次选择主导份额较小的租户，相同时按租户名
+	order := make([]string, 0)
+	for !mts.scheduleQ.empty() {
+		cpuShare, netShare := mts.DominantShare("cpu"), mts.DominantShare("net")
+		app := mts.scheduleQ.pop()
+		order = append(order, app.tenant)
+		if (app.tenant == "cpu" && cpuShare > netShare) || (app.tenant == "net" && netShare >= cpuShare) {
+			t.Fatalf("expect the tenant with the smaller dominant share to be picked: cpu=%.3f, net=%.3f, picked %s", cpuShare, netShare, app.tenant)
+		}
+		ms2node, err := mts.schedule(app.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mts.doPlacement(app.id, ms2node)
+		fmt.Printf("%s: cpu share=%.3f, net share=%.3f\n", app.id, mts.DominantShare("cpu"), mts.DominantShare("net"))
+	}
+	fmt.Println("order:", order)
+	if fmt.Sprint(order) != "[cpu net net cpu net cpu]" {
+		t.Fatalf("unexpected pick order %v", order)
+	}
+	total := cluster.totalCapacity()
+	res, band := mts.TenantUsage("net")
+	if !approxEqual(mts.DominantShare("net"), band/total.band) || res[ResCPU]/total.res[ResCPU] >= band/total.band {
+		t.Fatalf("expect the dominant share of tenant net to come from bandwidth, got %.3f", mts.DominantShare("net"))
+	}
+}
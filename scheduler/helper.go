@@ -3,7 +3,9 @@ package scheduler
 import (
 	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/WeixinX/topology-aware-scheduling-framework/util"
 )
@@ -12,30 +14,189 @@ import (
 // appQueue 微服务应用调度优先级队列
 //
 type appQueue struct {
-	mu sync.RWMutex
-	pq *util.PriorityQueue
+	mu      sync.RWMutex
+	epoch   time.Time                      // reference time of enqueue times
+	aging   float32                        // priority gained per second of waiting
+	fair    bool                           // whether apps of different tenants are served by weighted fair queuing
+	weights map[string]float32             // weights of tenants, 1 if absent
+	tenants map[string]*util.PriorityQueue // queue of each tenant, all apps are in the "" queue when fair queuing is off
+	pass    map[string]float64             // virtual time of each tenant
+	vtime   float64                        // virtual time of the last served tenant
+	picker  tenantPicker                   // picks the tenant to serve, weighted fair queuing if nil
 }
 
+// tenantPicker 从有应用等待的租户中选出下一个被调度的租户，在出队时调用，可读取调度器状态，出队的调用者需持有 m.mu
+type tenantPicker func(active []string) string
+
 func newAppQueue(length int) *appQueue {
-	return &appQueue{pq: util.NewPriorityQueue(length)}
+	return &appQueue{
+		epoch:   time.Now(),
+		weights: make(map[string]float32),
+		tenants: map[string]*util.PriorityQueue{"": util.NewPriorityQueue(length)},
+		pass:    make(map[string]float64),
+	}
+}
+
+// key 应用在队列中的优先级：等待时间越长有效优先级越高，
+// 有效优先级 priority + aging * (now - enqueuedAt) 的排序与 now 无关，等价于 priority - aging * enqueuedAt
+func (aq *appQueue) key(app *Service) float32 {
+	return float32(app.priority) - aq.aging*float32(app.enqueuedAt.Sub(aq.epoch).Seconds())
+}
+
+func (aq *appQueue) tenantOf(app *Service) string {
+	if !aq.fair {
+		return ""
+	}
+	return app.tenant
+}
+
+func (aq *appQueue) weightOf(tenant string) float32 {
+	if w, ok := aq.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
 }
 
 func (aq *appQueue) push(app *Service) {
 	aq.mu.Lock()
 	defer aq.mu.Unlock()
-	aq.pq.Push(util.NewEntry(app, float32(app.priority)))
+	aq.pushLocked(app)
+}
+
+func (aq *appQueue) pushLocked(app *Service) {
+	if app.enqueuedAt.IsZero() {
+		app.enqueuedAt = time.Now()
+	}
+	tenant := aq.tenantOf(app)
+	q, ok := aq.tenants[tenant]
+	if !ok {
+		q = util.NewPriorityQueue(AppQIniLen)
+		aq.tenants[tenant] = q
+	}
+	if q.Empty() && aq.pass[tenant] < aq.vtime { // 空闲的租户重新活跃时不能累积之前的份额
+		aq.pass[tenant] = aq.vtime
+	}
+	q.Push(util.NewEntryAt(app, aq.key(app), app.enqueuedAt))
 }
 
 func (aq *appQueue) pop() *Service {
 	aq.mu.Lock()
 	defer aq.mu.Unlock()
-	return util.ExtractItemFromEntry(aq.pq.Pop()).(*Service)
+	return aq.popLocked()
+}
+
+func (aq *appQueue) popLocked() *Service {
+	tenant := ""
+	if aq.fair {
+		active := aq.activeTenants()
+		if aq.picker != nil {
+			tenant = aq.picker(active)
+		} else {
+			tenant = aq.pickWFQ(active)
+		}
+		aq.vtime = aq.pass[tenant]
+		aq.pass[tenant] += 1 / float64(aq.weightOf(tenant))
+	}
+	return util.ExtractItemFromEntry(aq.tenants[tenant].Pop()).(*Service)
+}
+
+// activeTenants 有应用等待的租户，按名称排序
+func (aq *appQueue) activeTenants() []string {
+	active := make([]string, 0, len(aq.tenants))
+	for tenant, q := range aq.tenants {
+		if !q.Empty() {
+			active = append(active, tenant)
+		}
+	}
+	sort.Strings(active)
+	return active
+}
+
+// pickWFQ 选择虚拟时间最小的租户，每调度一个应用租户的虚拟时间增加 1/weight
+func (aq *appQueue) pickWFQ(active []string) string {
+	ret := active[0]
+	for _, tenant := range active[1:] {
+		if aq.pass[tenant] < aq.pass[ret] {
+			ret = tenant
+		}
+	}
+	return ret
+}
+
+// remove 从队列中删除应用，其余应用保持原来的先后顺序
+func (aq *appQueue) remove(app *Service) {
+	aq.mu.Lock()
+	defer aq.mu.Unlock()
+
+	for _, q := range aq.tenants {
+		kept := make([]*Service, 0, q.Len())
+		for !q.Empty() {
+			if a := util.ExtractItemFromEntry(q.Pop()).(*Service); a != app {
+				kept = append(kept, a)
+			}
+		}
+		for _, a := range kept {
+			q.Push(util.NewEntryAt(a, aq.key(a), a.enqueuedAt))
+		}
+	}
 }
 
 func (aq *appQueue) empty() bool {
 	aq.mu.RLock()
 	defer aq.mu.RUnlock()
-	return aq.pq.Empty()
+	for _, q := range aq.tenants {
+		if !q.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (aq *appQueue) len() int {
+	aq.mu.RLock()
+	defer aq.mu.RUnlock()
+	n := 0
+	for _, q := range aq.tenants {
+		n += q.Len()
+	}
+	return n
+}
+
+// setAging 设置每秒等待时间带来的优先级提升
+func (aq *appQueue) setAging(rate float32) {
+	aq.rebuild(func() { aq.aging = rate })
+}
+
+// setFairness 开启或关闭租户间的公平队列，weights 为各租户权重，picker 为 nil 时使用加权公平队列选择租户
+func (aq *appQueue) setFairness(fair bool, weights map[string]float32, picker tenantPicker) {
+	aq.rebuild(func() {
+		aq.fair, aq.picker = fair, picker
+		aq.weights = make(map[string]float32)
+		for tenant, w := range weights {
+			aq.weights[tenant] = w
+		}
+	})
+}
+
+// rebuild 取出队列中的全部应用，修改队列设置后按入队时间先后重新入队
+func (aq *appQueue) rebuild(change func()) {
+	aq.mu.Lock()
+	defer aq.mu.Unlock()
+
+	apps := make([]*Service, 0)
+	for _, tenant := range aq.activeTenants() {
+		q := aq.tenants[tenant]
+		for !q.Empty() {
+			apps = append(apps, util.ExtractItemFromEntry(q.Pop()).(*Service))
+		}
+	}
+	sort.SliceStable(apps, func(i, j int) bool { return apps[i].enqueuedAt.Before(apps[j].enqueuedAt) })
+	change()
+	aq.tenants = map[string]*util.PriorityQueue{"": util.NewPriorityQueue(AppQIniLen)}
+	aq.pass, aq.vtime = make(map[string]float64), 0
+	for _, app := range apps {
+		aq.pushLocked(app)
+	}
 }
 
 //
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAppQueueFIFOAndAging(t *testing.T) {
+	aq := newAppQueue(AppQIniLen)
+	now := time.Now()
+	old := &Service{id: "old", priority: 1, enqueuedAt: now.Add(-10 * time.Second)}
+	a := &Service{id: "a", priority: 2, enqueuedAt: now}
+	b := &Service{id: "b", priority: 2, enqueuedAt: now}
+	for _, app := range []*Service{old, a, b} {
+		aq.push(app)
+	}
+	if got := aq.pop().id; got != "a" {
+		t.Fatalf("expect a without aging, got %s", got)
+	}
+	if got := aq.pop().id; got != "b" {
+		t.Fatalf("expect b to follow a in FIFO order, got %s", got)
+	}
+	aq.push(a)
+	aq.push(b)
+
+	aq.setAging(0.5) // 等待 10s 的应用优先级提升 5
+	for _, want := range []appId{"old", "a", "b"} {
+		got := aq.pop().id
+		fmt.Println(got)
+		if got != want {
+			t.Fatalf("expect %s with aging, got %s", want, got)
+		}
+	}
+}
+
+func TestAppQueueFairQueuing(t *testing.T) {
+	aq := newAppQueue(AppQIniLen)
+	aq.setFairness(true, map[string]float32{"heavy": 2}, nil)
+	for i := 0; i < 6; i++ {
+		aq.push(&Service{id: appId(fmt.Sprintf("heavy%d", i)), tenant: "heavy", priority: 10})
+		aq.push(&Service{id: appId(fmt.Sprintf("light%d", i)), tenant: "light"})
+	}
+
+	served := map[string]int{}
+	for i := 0; i < 6; i++ {
+		app := aq.pop()
+		fmt.Println(app.id)
+		served[app.tenant]++
+	}
+	if served["heavy"] != 4 || served["light"] != 2 {
+		t.Fatalf("expect tenants to be served by weight 2:1, got %v", served)
+	}
+
+	aq.setFairness(false, nil, nil)
+	if aq.len() != 6 || aq.pop().tenant != "heavy" {
+		t.Fatalf("expect a single priority queue after fair queuing is off")
+	}
+}
+
+func TestAppQueueEnqueueOrder(t *testing.T) {
+	aq := newAppQueue(AppQIniLen)
+	aq.setFairness(true, nil, nil)
+	now := time.Now()
+	first := &Service{id: "first", priority: 1, tenant: "b", enqueuedAt: now.Add(-2 * time.Second)}
+	second := &Service{id: "second", priority: 1, tenant: "a", enqueuedAt: now.Add(-time.Second)}
+	third := &Service{id: "third", priority: 1, tenant: "b", enqueuedAt: now}
+	for _, app := range []*Service{third, second, first} {
+		aq.push(app)
+	}
+
+	aq.setFairness(false, nil, nil) // 重建后按入队时间而不是租户名称出队
+	for _, want := range []appId{"first", "second", "third"} {
+		if got := aq.pop().id; got != want {
+			t.Fatalf("expect %s after rebuilding, got %s", want, got)
+		}
+	}
+
+	aq.push(third)
+	aq.push(first) // 从退避队列重新入队的应用保留原入队时间
+	if got := aq.pop().id; got != "first" {
+		t.Fatalf("expect the app enqueued earlier to be served first, got %s", got)
+	}
+}
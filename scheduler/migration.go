@@ -0,0 +1,217 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+)
+
+//
+// MigrationPlan 迁移计划：按顺序执行的一组微服务迁移
+//
+type MigrationPlan struct {
+	moves []*Migration
+}
+
+// Migration 将已放置的微服务从 from 迁移到 to，resReq 为迁移后申请的资源，nil 表示不变
+type Migration struct {
+	app    appId
+	ms     msId
+	from   nodeId
+	to     nodeId
+	resReq map[ResourceType]Resource
+}
+
+func (p *MigrationPlan) String() string {
+	var sb strings.Builder
+	for _, mv := range p.moves {
+		fmt.Fprintf(&sb, "%s/%s: %s -> %s\n", mv.app, mv.ms, mv.from, mv.to)
+	}
+	return sb.String()
+}
+
+// Len 迁移计划中的迁移次数
+func (p *MigrationPlan) Len() int {
+	return len(p.moves)
+}
+
+// ApplyPlan 执行迁移计划
+func (m *MOTAS) ApplyPlan(plan *MigrationPlan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.applyPlan(plan)
+}
+
+// applyPlan 在一个事务中按顺序执行迁移：回收微服务在原节点上的资源及其流量的链路带宽，按迁移后的资源在目标节点上重新预留。
+// 每次迁移的目标节点需通过节点过滤（选择器和污点、资源容量、资源均衡阈值、链路带宽），全部迁移后不超出节点资源、链路带宽容量
+// 以及租户配额且各应用满足应用级约束时提交，否则放弃整个计划，调用者需持有 m.mu
+func (m *MOTAS) applyPlan(plan *MigrationPlan) error {
+	type saved struct {
+		ms     *Microservice
+		resReq map[ResourceType]Resource
+	}
+	var (
+		c     = m.cluster.begin()
+		moved = make([]saved, 0, len(plan.moves))
+		apps  = make(map[appId]*Service)
+	)
+	undo := func() {
+		for i := len(moved) - 1; i >= 0; i-- {
+			moved[i].ms.nextPlaceNode, moved[i].ms.resReq = moved[i].ms.placeNode, moved[i].resReq
+		}
+	}
+	for _, mv := range plan.moves {
+		app, ok := m.app[mv.app]
+		if !ok || !app.placed {
+			undo()
+			return fmt.Errorf("app %s is not placed", mv.app)
+		}
+		ms, ok := app.ms[mv.ms]
+		if !ok || ms.nextPlaceNode != mv.from {
+			undo()
+			return fmt.Errorf("ms %s/%s is not on node %s", mv.app, mv.ms, mv.from)
+		}
+		if _, ok := c.nodes[mv.to]; !ok && !ms.external {
+			undo()
+			return fmt.Errorf("unknown node %s", mv.to)
+		}
+		if ms.fixed() && mv.to != ms.pinNode {
+			undo()
+			return fmt.Errorf("ms %s/%s is pinned to node %s", mv.app, mv.ms, ms.pinNode)
+		}
+		m.detach(c, app, mv.ms)
+		moved = append(moved, saved{ms: ms, resReq: ms.resReq})
+		if mv.resReq != nil {
+			ms.resReq = mv.resReq
+		}
+		if !ms.external && !c.fits(app, mv.ms, mv.to) {
+			undo()
+			return fmt.Errorf("ms %s/%s does not fit node %s: selector, taints, capacity, threshold or bandwidth", mv.app, mv.ms, mv.to)
+		}
+		m.attach(c, app, mv.ms, mv.to)
+		apps[app.id] = app
+	}
+
+	err := c.tx.validate()
+	for _, app := range apps { // 副本打散、硬亲和/反亲和约束以及时延 SLO
+		if err == nil {
+			err = m.validatePlacement(c, app.id)
+		}
+	}
+	if err == nil {
+		err = m.checkTenants(m.usageDelta(apps))
+	}
+	if err != nil {
+		undo()
+		return err
+	}
+	c.commit()
+	m.version++
+	for _, app := range apps {
+		app.commitPlaceStat()
+		if app.reserved != nil {
+			m.usage[app.tenant].add(app.reserved, -1)
+		}
+		m.reserve(app)
+	}
+	m.refreshCrossCalls()
+	m.admitHeld()
+	m.retryUnschedulable() // 迁移可能腾出资源
+	for _, mv := range plan.moves {
+		DLogINFO("🚚 ms %s/%s is migrated from node %s to node %s", mv.app, mv.ms, mv.from, mv.to)
+	}
+	return nil
+}
+
+// fits 判断微服务 mid 能否放置在节点 nid 上，即 nid 是否通过 filterBalanceNode 的过滤
+func (c *Cluster) fits(app *Service, mid msId, nid nodeId) bool {
+	nodes, _ := c.filterBalanceNode(app, mid)
+	for _, id := range nodes {
+		if id == nid {
+			return true
+		}
+	}
+	return false
+}
+
+// usageDelta 按租户汇总应用按预放置位置的用量相对已计入用量的变化
+func (m *MOTAS) usageDelta(apps map[appId]*Service) map[string]*resUsage {
+	ret := make(map[string]*resUsage)
+	for _, app := range apps {
+		u := app.usageOf(m.cluster, true)
+		if app.reserved != nil {
+			u.add(app.reserved, -1)
+		}
+		if _, ok := ret[app.tenant]; !ok {
+			ret[app.tenant] = newResUsage()
+		}
+		ret[app.tenant].add(u, 1)
+	}
+	return ret
+}
+
+// placedTraffic 返回微服务 mid 与对端之间按预放置节点预留了链路带宽的全部流量：应用内的上下游调用、入口流量，
+// 以及与其他应用之间的跨应用调用
+func (m *MOTAS) placedTraffic(app *Service, mid msId) []traffic {
+	ret := make([]traffic, 0, len(app.dep[mid])+len(app.reDep[mid]))
+	for _, dep := range app.dep[mid] {
+		ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: app.ms[dep.dmId].nextPlaceNode, trans: dep.trans})
+	}
+	for _, dep := range app.reDep[mid] {
+		ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: app.ms[dep.umId].nextPlaceNode, trans: dep.trans})
+	}
+	ret = append(ret, app.ingressOf(mid)...)
+	for _, call := range app.crossCalls {
+		if call.umId == mid {
+			peer := m.app[call.dmApp].ms[call.dmId].nextPlaceNode
+			ret = append(ret, traffic{umId: mid, dmId: batchMsId(call.dmApp, call.dmId), peer: peer, trans: call.trans})
+		}
+	}
+	for _, caller := range m.app {
+		for _, call := range caller.crossCalls {
+			if call.dmApp == app.id && call.dmId == mid {
+				peer := caller.ms[call.umId].nextPlaceNode
+				ret = append(ret, traffic{umId: batchMsId(caller.id, call.umId), dmId: mid, peer: peer, trans: call.trans})
+			}
+		}
+	}
+	return ret
+}
+
+// detach 在事务视图 c 中回收微服务在预放置节点上占用的资源及其全部流量的链路带宽
+func (m *MOTAS) detach(c *Cluster, app *Service, mid msId) {
+	ms := app.ms[mid]
+	if !ms.external {
+		c.decAllNextAlloc(ms.nextPlaceNode, ms.resReq)
+		c.updateNextGama(ms.nextPlaceNode)
+	}
+	for _, t := range m.placedTraffic(app, mid) {
+		c.decNextBandAlloc(ms.nextPlaceNode, t.peer, t.trans)
+	}
+}
+
+// attach 在事务视图 c 中将微服务预放置到节点 nid 上，预留其资源及其全部流量的链路带宽
+func (m *MOTAS) attach(c *Cluster, app *Service, mid msId, nid nodeId) {
+	ms := app.ms[mid]
+	ms.nextPlaceNode = nid
+	if !ms.external {
+		c.incAllNextAlloc(nid, ms.resReq)
+		c.updateNextGama(nid)
+	}
+	for _, t := range m.placedTraffic(app, mid) {
+		c.incNextBandAlloc(nid, t.peer, t.trans)
+	}
+}
+
+// refreshCrossCalls 按两端微服务当前的放置节点更新跨应用调用记录，调用者需持有 m.mu
+func (m *MOTAS) refreshCrossCalls() {
+	for _, app := range m.app {
+		for i := range app.crossCalls {
+			call := &app.crossCalls[i]
+			call.from = app.ms[call.umId].placeNode
+			if peer, ok := m.app[call.dmApp]; ok {
+				call.to = peer.ms[call.dmId].placeNode
+			}
+		}
+	}
+}
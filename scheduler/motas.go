@@ -1,8 +1,10 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,23 +22,60 @@ type MOTAS struct {
 	alphaC    float32            // argument of the score function for cost
 	alphaI    float32            // argument of the score function for inter
 	alphaF    float32            // argument of the score function for frag
+	alphaL    float32            // argument of the score function for latency
+
+	preemptions   []*Preemption        // records of preemption
+	backoffQ      []*Service           // failed apps waiting for their backoff to expire
+	unschedulable map[appId]*Service   // apps that exceed the max attempts, retried when cluster capacity changes
+	maxAttempts   int                  // max scheduling attempts before an app becomes unschedulable
+	backoffBase   time.Duration        // backoff after the first failed attempt, doubled after each failure
+	backoffMax    time.Duration        // upper bound of the backoff
+	quotas        map[string]*resUsage // tenant -> quota
+	usage         map[string]*resUsage // tenant -> resources and bandwidth of placed apps
+	quotaPolicy   QuotaPolicy          // whether apps over quota are rejected or held
+	held          []*Service           // apps held because they would go over the tenant quota
+	rejected      map[appId]error      // apps rejected after mapping because they would go over the tenant quota
+	workers       int                  // max number of apps mapped in parallel
+	forkSem       chan struct{}        // caps the sub-problems of recursive mapping that run in parallel
+	version       uint64               // incremented on every change of the committed cluster state
+	conflicts     int                  // attempts that conflicted with an app committed in between
+	autoscale     *AutoscalePolicy     // horizontal autoscaling policy, nil means disabled
+	reschedule    *ReschedulePolicy    // periodic rescheduling policy, nil means disabled
 }
 
 func NewMOTAS(cluster *Cluster) *MOTAS {
-	mts := &MOTAS{
-		mu:        sync.RWMutex{},
-		app:       make(map[appId]*Service),
-		cluster:   cluster,
-		scheduleQ: newAppQueue(AppQIniLen),
-		alphaC:    AlphaC,
-		alphaI:    AlphaI,
-		alphaF:    AlphaF,
-	}
+	mts := newMOTAS(cluster)
 	go mts.run()
 
 	return mts
 }
 
+// newMOTAS 创建 MOTAS 但不运行调度循环
+func newMOTAS(cluster *Cluster) *MOTAS {
+	return &MOTAS{
+		mu:            sync.RWMutex{},
+		app:           make(map[appId]*Service),
+		cluster:       cluster,
+		scheduleQ:     newAppQueue(AppQIniLen),
+		alphaC:        AlphaC,
+		alphaI:        AlphaI,
+		alphaF:        AlphaF,
+		alphaL:        AlphaL,
+		backoffQ:      make([]*Service, 0),
+		unschedulable: make(map[appId]*Service),
+		maxAttempts:   MaxAttempts,
+		backoffBase:   BackoffBase,
+		backoffMax:    BackoffMax,
+		quotas:        make(map[string]*resUsage),
+		usage:         make(map[string]*resUsage),
+		quotaPolicy:   QuotaReject,
+		held:          make([]*Service, 0),
+		rejected:      make(map[appId]error),
+		workers:       runtime.NumCPU(),
+		forkSem:       make(chan struct{}, runtime.NumCPU()),
+	}
+}
+
 func (m *MOTAS) Kill() {
 	atomic.StoreUint32(&m.death, 1)
 }
@@ -50,37 +89,8 @@ func (m *MOTAS) run() {
 	DLogINFO("▶️ start running MOTAS...")
 	defer DLogINFO("⏹ end running MOTAS...")
 
-	var (
-		app     *Service
-		ms2node map[msId]nodeId
-		err     error
-	)
-
 	for !m.killed() {
-		for !m.scheduleQ.empty() {
-			app = m.scheduleQ.pop()
-			m.app[app.id] = app
-			DLogINFO("⏰ app(id=%s) is being scheduled", app.id)
-			ms2node, err = m.recursiveMapping(app.id, app.ms, m.cluster)
-			if err != nil || len(ms2node) == 0 { // 没能得到一个有效的映射结果，降低该应用调度优先级并重新放入队列（错误类型只有资源不足）
-				// 状态回滚
-				m.cluster.rollbackStat()
-				app.rollbackPlaceStat()
-				// 降低优先级并重入队列
-				app.decPriority()
-				m.scheduleQ.push(app)
-				DLogINFO("❌ app(id=%s) scheduling fails, lowers the priority and re-enters the queue", app.id)
-			} else {
-				m.doPlacement(app.id, ms2node) // 根据映射关系将微服务放置到对应的工作节点上
-				DLogINFO("✅ app(id=%s) was scheduled successfully", app.id)
-				DLogINFO("the mapping of microservices and worker nodes:")
-				for mid, nid := range ms2node {
-					DLogINFO("- ms:%s -> node:%s", mid, nid)
-				}
-			}
-			m.Kill() //
-			break    //
-		}
+		m.tick()
 		time.Sleep(100 * time.Millisecond)
 	}
 	for _, node := range m.cluster.nodes {
@@ -97,9 +107,199 @@ func (m *MOTAS) run() {
 	}
 }
 
-func (m *MOTAS) AddTask(app *Service) {
+// tick 调度循环的一轮：重新入队退避结束的应用，按策略扩缩容和重调度，再调度队列中的全部应用
+func (m *MOTAS) tick() {
+	m.flushBackoff() // 退避结束的应用重新进入调度队列
+	if m.autoscaleDue() {
+		m.Autoscale()
+	}
+	if m.rescheduleDue() {
+		m.Reschedule()
+	}
+	for !m.scheduleQ.empty() { // 多个应用并发映射，调度失败的应用已进入退避队列，不阻塞其后的应用
+		m.scheduleBatch(m.workers)
+	}
+}
+
+// RemoveApp 移除应用，已放置的应用回收其占用的资源和链路带宽，并重试不可调度的应用
+func (m *MOTAS) RemoveApp(aid appId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.app[aid]
+	if !ok {
+		return fmt.Errorf("app %s not found", aid)
+	}
+	app.removed = true // 正在映射的应用在提交时丢弃
+	app.gen++
+	m.forget(app)
+	if app.placed {
+		c := m.cluster.begin()
+		m.releaseApps(c, aid)
+		c.commit()
+		m.version++
+		app.placed = false
+		m.dropCrossCalls(aid)
+		m.unreserve(app)
+	}
+	delete(m.app, aid)
+	delete(m.unschedulable, aid)
+	DLogINFO("app(id=%s) is removed", aid)
+	m.retryUnschedulable()
+	return nil
+}
+
+// forget 从调度队列、退避队列和暂缓队列中删除应用，调用者需持有 m.mu
+func (m *MOTAS) forget(app *Service) {
+	m.scheduleQ.remove(app)
+	backoff := m.backoffQ[:0]
+	for _, a := range m.backoffQ {
+		if a != app {
+			backoff = append(backoff, a)
+		}
+	}
+	m.backoffQ = backoff
+	held := m.held[:0]
+	for _, a := range m.held {
+		if a != app {
+			held = append(held, a)
+		}
+	}
+	m.held = held
+}
+
+// AddNode 向集群添加工作节点及其链路，并重试不可调度的应用
+func (m *MOTAS) AddNode(node *Node, links []*Link) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cluster.nodes[node.id] = node
+	for _, link := range links {
+		if m.cluster.links[link.from] == nil {
+			m.cluster.links[link.from] = make(map[nodeId]*Link)
+		}
+		m.cluster.links[link.from][link.to] = link
+	}
+	m.version++
+	DLogINFO("node(id=%s) is added", node.id)
+	m.retryUnschedulable()
+}
+
+// AddTask 准入应用并放入调度队列，应用申请的资源超出租户配额时按配额策略拒绝（返回错误）或暂缓调度
+func (m *MOTAS) AddTask(app *Service) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app.readmit()
+	delete(m.rejected, app.id)
+	app.expandReplicas()
+	demand := app.byTenant((*Service).demand)
+	if err := m.checkTenants(demand); err != nil {
+		if m.quotaPolicy == QuotaReject {
+			DLogINFO("🚫 app(id=%s) is rejected: %v", app.id, err)
+			return err
+		}
+		m.app[app.id] = app
+		m.hold(app, demand, err)
+		return nil
+	}
+	m.app[app.id] = app
 	DLogINFO("app(id=%s) enters the scheduling queue", app.id)
 	m.scheduleQ.push(app)
+	return nil
+}
+
+// SetAging 设置调度队列的老化速率，应用每等待一秒有效优先级提升 rate，避免低优先级应用饥饿
+func (m *MOTAS) SetAging(rate float32) {
+	m.scheduleQ.setAging(rate)
+}
+
+// SetFairQueuing 按租户权重在租户之间进行加权公平调度，weights 为 nil 时关闭公平队列
+func (m *MOTAS) SetFairQueuing(weights map[string]float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.scheduleQ.setFairness(weights != nil, weights, nil)
+}
+
+// schedule 对应用进行一次调度尝试，成功时返回微服务与工作节点的映射关系，预分配记录在应用的事务中等待提交；失败时放弃事务
+func (m *MOTAS) schedule(aid appId) (map[msId]nodeId, error) {
+	return m.scheduleOn(m.cluster.begin(), aid)
+}
+
+// scheduleOn 在事务视图 c 上对应用进行一次调度尝试
+func (m *MOTAS) scheduleOn(c *Cluster, aid appId) (map[msId]nodeId, error) {
+	app := m.app[aid]
+	m.resolveRemote(app)
+	err := m.prePlace(c, aid)
+	var ms2node map[msId]nodeId
+	if err == nil {
+		ms2node, err = m.recursiveMapping(aid, app.schedulable(), c)
+	}
+	if err == nil {
+		err = m.validatePlacement(c, aid)
+	}
+	if err == nil {
+		for mid, ms := range app.ms { // 固定位置的微服务
+			if ms.fixed() {
+				ms2node[mid] = ms.pinNode
+			}
+		}
+		if len(ms2node) == 0 {
+			err = errors.New("no microservice is mapped")
+		}
+	}
+	if err != nil { // 放弃事务，只需回滚应用的预放置状态
+		app.rollbackPlaceStat()
+		return nil, err
+	}
+	app.tx = c.tx
+	return ms2node, nil
+}
+
+// prePlace 预放置固定位置的微服务：固定到节点的微服务预分配节点资源，固定位置微服务之间的流量预分配链路带宽，
+// 它们不参与划分，但会作为已放置的对端吸引与之通信的微服务
+func (m *MOTAS) prePlace(c *Cluster, aid appId) error {
+	app := m.app[aid]
+	app.settled = nil
+	for _, ms := range app.ms {
+		if !ms.fixed() {
+			continue
+		}
+		ms.placeNode, ms.nextPlaceNode = ms.pinNode, ms.pinNode
+		if ms.external {
+			continue
+		}
+		node, ok := c.nodes[ms.pinNode]
+		if !ok {
+			return fmt.Errorf("ms %s is pinned to an unknown node %s", ms.id, ms.pinNode)
+		}
+		for typ, req := range ms.resReq {
+			if req.value+c.nextAllocOf(node, typ) > node.capa[typ].value {
+				return fmt.Errorf("out of resources: ms %s is pinned to node %s", ms.id, ms.pinNode)
+			}
+		}
+		c.incAllNextAlloc(ms.pinNode, ms.resReq)
+		c.updateNextGama(ms.pinNode)
+	}
+	for _, ms := range app.ms {
+		if !ms.fixed() {
+			continue
+		}
+		for _, t := range app.remoteOf(ms.id) {
+			if err := c.reserveFixed(ms.pinNode, t.peer, t.trans); err != nil {
+				return err
+			}
+		}
+		for _, dep := range app.dep[ms.id] {
+			if dm := app.ms[dep.dmId]; dm.fixed() {
+				if err := c.reserveFixed(ms.pinNode, dm.pinNode, dep.trans); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
 }
 
 // recursiveMapping 递归求解微服务与工作节点的映射关系
@@ -114,31 +314,35 @@ func (m *MOTAS) recursiveMapping(aid appId, mss map[msId]*Microservice, cluster
 		for _, n := range cluster.nodes { // 取出唯一节点
 			node = n
 		}
+		for _, ms := range mss { // 划分时已按节点选择器和污点过滤，这里再做一次兜底检查
+			if !node.admits(ms) {
+				return ms2node, fmt.Errorf("ms %s can not be placed on node %s: selector or taints mismatch", ms.id, node.id)
+			}
+		}
 		fmt.Printf("pre-placement: ")
 		for _, ms := range mss { // 建立服务和工作节点的映射关系，预分配资源
 			fmt.Printf("map %s->%s  ", ms.id, node.id)
 			ms2node[ms.id] = node.id
 			m.app[aid].setNextPlaceNode(ms.id, node.id)
-			m.cluster.incAllNextAlloc(node.id, ms.resReq)
-			m.cluster.updateNextGama(node.id)
-			for _, dep := range m.app[aid].dep[ms.id] {
-				dm := m.app[aid].ms[dep.dmId]
-				m.cluster.incNextBandAlloc(node.id, dm.nextPlaceNode, dep.trans)
+			cluster.incAllNextAlloc(node.id, ms.resReq)
+			cluster.updateNextGama(node.id)
+			for _, t := range m.app[aid].settle(ms.id) { // 两端位置都确定后才预分配链路带宽
+				cluster.incNextBandAlloc(node.id, t.peer, t.trans)
 			}
 		}
 		fmt.Println()
 
 		//
-		for _, node = range m.cluster.nodes {
+		for _, node = range cluster.top().nodes {
 			fmt.Printf("%s: \n", node.id)
 			for _, typ := range node.resType {
-				fmt.Printf("- %v: next alloc/cap=%.2f/%.2f\n", typ, node.nextAlloc[typ].value, node.capa[typ].value)
+				fmt.Printf("- %v: next alloc/cap=%.2f/%.2f\n", typ, cluster.nextAllocOf(node, typ), node.capa[typ].value)
 			}
 			fmt.Println()
 		}
-		for _, links := range m.cluster.links {
+		for _, links := range cluster.links {
 			for _, link := range links {
-				fmt.Printf("%s -> %s: next alloc/cap=%.2f/%.2f\n", link.from, link.to, link.nextBandAlloc, link.bandCap)
+				fmt.Printf("%s -> %s: next alloc/cap=%.2f/%.2f\n", link.from, link.to, cluster.nextBandOf(link), link.bandCap)
 			}
 		}
 		//
@@ -155,7 +359,13 @@ func (m *MOTAS) recursiveMapping(aid appId, mss map[msId]*Microservice, cluster
 		ms2node0 map[msId]nodeId
 		ms2node1 map[msId]nodeId
 	)
-	if lfirst {
+	if sem := m.forkSem; m.app[aid].independent(mss0, mss1) && tryAcquire(sem) { // 两个子问题相互独立时并行递归
+		ms2node0, ms2node1, err = m.mapParallel(aid, mss0, mss1, cluster, c0, c1)
+		<-sem
+		if err != nil {
+			return ms2node, err
+		}
+	} else if lfirst {
 		ms2node0, err = m.recursiveMapping(aid, mss0, c0) // 递归处理 c0 分区
 		if err != nil {
 			return ms2node, err
@@ -187,10 +397,18 @@ func (m *MOTAS) doPlacement(aid appId, ms2node map[msId]nodeId) {
 	//TODO：
 	// - 1. 与 k8s 进行交互
 	// - 2. 调用相关 commit 操作更新集群资源状态
-	m.cluster.commitAlloc()
-	m.cluster.commitGama()
-	m.cluster.commitBandAlloc()
+	m.app[aid].tx.commit()
+	m.app[aid].tx = nil
+	m.version++
 	m.app[aid].commitPlaceStat()
+	m.app[aid].placed = true
+	m.app[aid].enqueuedAt = time.Time{}
+	if m.app[aid].members != nil { // 批量应用拆分为各成员应用
+		m.unpack(m.app[aid])
+		return
+	}
+	m.app[aid].recordRemote()
+	m.reserve(m.app[aid])
 }
 
 // nodePartition 使用 Fiduccia-Mattheyses 算法得到具有最小分割（cut size）的工作节点划分方案
@@ -213,7 +431,7 @@ func (m *MOTAS) nodePartition(cluster *Cluster) (*Cluster, *Cluster) {
 		for _, lid := range record.left { // 假设节点通信是无向的
 			for _, rid := range record.right {
 				if link, ok := cluster.links[lid][rid]; ok {
-					cost += link.cost
+					cost += cluster.linkCost(link)
 				}
 			}
 		}
@@ -223,16 +441,8 @@ func (m *MOTAS) nodePartition(cluster *Cluster) (*Cluster, *Cluster) {
 		}
 	}
 
-	c0 := &Cluster{
-		nodes: make(map[nodeId]*Node),
-		links: cluster.links,
-		hpg:   nil,
-	}
-	c1 := &Cluster{
-		nodes: make(map[nodeId]*Node),
-		links: cluster.links,
-		hpg:   nil,
-	}
+	c0 := cluster.subCluster()
+	c1 := cluster.subCluster()
 	for _, nid := range records[minIdx].left {
 		c0.nodes[nid] = cluster.nodes[nid]
 	}
@@ -247,25 +457,11 @@ func (m *MOTAS) nodePartition(cluster *Cluster) (*Cluster, *Cluster) {
 func (m *MOTAS) microservicePartition(aid appId, mss map[msId]*Microservice, cluster0 *Cluster, cluster1 *Cluster) (
 	map[msId]*Microservice, map[msId]*Microservice, bool, error) {
 
-	// 需要在退出函数后恢复集群状态
-	//FIXME:
-	// - 用这个来取代后面的状态撤销操作，但有 bug, why...
-	// - 因为快照是整个 cluster 的，而这里分了左右 c0、c1，造成 cluster 和 c0、c1 数据不一致
-	// - 在递归调用时使用的是 c0、c1，所以在分配资源时有超过 capacity 的错误
-	//cSnapshot := m.cluster.clone()
-	//fmt.Println("snapshot:")
-	//defer func() { m.cluster = cSnapshot }()
-	//
-
-	//
-	type nodeR struct {
-		maxGama float32
-		minGama float32
-	}
-	mids := make([]msId, 0, len(mss)) // 记录微服务顺序
-	msR := make(map[msId]nodeId)      // 记录服务对应的节点
-	nR := make(map[nodeId]nodeR)      // 记录节点信息
-	//
+	// 划分过程中的预分配只用于评估后续微服务，记录在子事务中，退出函数时放弃
+	tx := newTxn(cluster0.tx)
+	c := cluster0.top().withTxn(tx)
+	c.branch = cluster0.branch
+	cluster0, cluster1 = cluster0.withTxn(tx), cluster1.withTxn(tx)
 
 	var (
 		nid    nodeId
@@ -289,44 +485,23 @@ func (m *MOTAS) microservicePartition(aid appId, mss map[msId]*Microservice, clu
 			return ms0, ms1, lfirst, err0
 		}
 
+		// 分别计算该微服务在两个分区上的效用值，分区不可用（资源不足、路径无效或链路饱和）时效用值取最大
 		var (
 			n0     nodeId
 			n1     nodeId
-			path0  map[nodeId][]nodeId
-			path1  map[nodeId][]nodeId
-			cost0  float32 = math.MaxFloat32 / 4
-			cost1  float32 = math.MaxFloat32 / 4
-			inter0 float32 = math.MaxFloat32 / 4
-			inter1 float32 = math.MaxFloat32 / 4
-			frag0  float32 = math.MaxFloat32 / 4
-			frag1  float32 = math.MaxFloat32 / 4
+			score0 float32
+			score1 float32
 		)
-		if err0 != nil { // 只计算在右分区的情况
-			cost1, n1, path1 = m.getMinCost(aid, mid, node1)
-			inter1 = m.getInter(aid, mid, n1, path1)
-			frag1 = m.getFrag(aid, mid, n1)
-
-		} else if err1 != nil { // 只计算在左分区的情况
-			cost0, n0, path0 = m.getMinCost(aid, mid, node0)
-			inter0 = m.getInter(aid, mid, n0, path0)
-			frag0 = m.getFrag(aid, mid, n0)
-
-		} else { // err0 == err1 == nil
-			// 分别计算该微服务在两个分区中的最小通信成本
-			cost0, n0, path0 = m.getMinCost(aid, mid, node0)
-			cost1, n1, path1 = m.getMinCost(aid, mid, node1)
-			// 分别计算该微服务在两个分区中最小通信成本节点上的网络干扰
-			inter0 = m.getInter(aid, mid, n0, path0)
-			inter1 = m.getInter(aid, mid, n1, path1)
-			// 分别计算该微服务在两个分区中最小通信成本节点上的资源碎片情况
-			frag0 = m.getFrag(aid, mid, n0)
-			frag1 = m.getFrag(aid, mid, n1)
-		}
-
-		// 分别计算该微服务在两个分区上的效用值
-		score0 := m.score(cost0, inter0, frag0)
-		score1 := m.score(cost1, inter1, frag1)
-		if score0 < score1 {
+		if err0 == nil {
+			score0, n0, err0 = m.evalPartition(c, aid, mid, node0)
+		}
+		if err1 == nil {
+			score1, n1, err1 = m.evalPartition(c, aid, mid, node1)
+		}
+		if err0 != nil && err1 != nil {
+			return ms0, ms1, lfirst, err0
+		}
+		if err1 != nil || (err0 == nil && score0 < score1) { // 右分区不可用时只能放置在左分区，反之亦然
 			fmt.Println(mid, "left")
 			ms0[mid] = mss[mid]
 			nid = n0
@@ -340,59 +515,89 @@ func (m *MOTAS) microservicePartition(aid appId, mss map[msId]*Microservice, clu
 		}
 		ms := m.app[aid].ms[mid]
 		prevNid := ms.nextPlaceNode
-		// 记录状态用于撤销
-		mids = append(mids, mid)
-		msR[mid] = nid
-		if _, ok := nR[nid]; !ok {
-			nR[nid] = nodeR{
-				maxGama: m.cluster.nodes[nid].nextMaxGama,
-				minGama: m.cluster.nodes[nid].nextMinGama,
-			}
-		}
-		//
-
 		m.app[aid].setNextPlaceNode(mid, nid)
 		fmt.Printf("ms=%s inc alloc, prev=%s, nid=%s\n", ms.id, prevNid, nid)
-		m.cluster.incAllNextAlloc(nid, ms.resReq)
-		m.cluster.updateNextGama(nid)
-		for _, dep := range m.app[aid].dep[mid] {
-			dm := m.app[aid].ms[dep.dmId]
-			m.cluster.incNextBandAlloc(nid, dm.nextPlaceNode, dep.trans)
+		c.incAllNextAlloc(nid, ms.resReq)
+		c.updateNextGama(nid)
+		for _, t := range m.app[aid].trafficOf(mid, true) {
+			c.incNextBandAlloc(nid, t.peer, t.trans)
 		}
 
 		i++
 	}
-	// 撤销状态
-	for _, mid := range mids {
-		nid = msR[mid]
-		m.cluster.decAllNextAlloc(nid, m.app[aid].ms[mid].resReq)
-		for _, dep := range m.app[aid].dep[mid] {
-			dm := m.app[aid].ms[dep.dmId]
-			m.cluster.decNextBandAlloc(nid, dm.nextPlaceNode, dep.trans)
-		}
+	return ms0, ms1, lfirst, nil
+}
+
+// evalPartition 计算微服务放置在候选节点集合上的效用值，返回最小通信成本节点及其效用值
+func (m *MOTAS) evalPartition(c *Cluster, aid appId, mid msId, nodes []nodeId) (float32, nodeId, error) {
+	if len(nodes) == 0 {
+		return math.MaxFloat32, NotPlaced, errors.New("out of resources") // 没有满足条件的节点
 	}
-	for id, r := range nR {
-		m.cluster.nodes[id].nextMinGama = r.minGama
-		m.cluster.nodes[id].nextMaxGama = r.maxGama
+	// 计算该微服务在分区中的最小通信成本
+	cost, nid, path := m.getMinCost(c, aid, mid, nodes)
+	// 计算该微服务在分区中最小通信成本节点上的网络干扰
+	inter, err := m.getInter(c, aid, mid, nid, path)
+	if err != nil {
+		return math.MaxFloat32, nid, err
 	}
-	//
-	return ms0, ms1, lfirst, nil
+	// 计算该微服务在分区中最小通信成本节点上的资源碎片情况
+	frag := m.getFrag(c, aid, mid, nid)
+	// 计算该微服务放置在最小通信成本节点上时应用的关键路径时延
+	lat := m.getLatency(c, aid, mid, nid)
+	// 违背软约束的惩罚
+	penalty := m.getPenalty(c, aid, mid, nid)
+	return m.score(cost, inter, frag, lat) + penalty, nid, nil
 }
 
-func (m *MOTAS) getMinCost(aid appId, mid msId, srcs []nodeId) (float32, nodeId, map[nodeId][]nodeId) {
+// validatePlacement 检查应用的预放置结果是否满足应用级约束（副本打散、硬亲和/反亲和约束、时延 SLO）
+func (m *MOTAS) validatePlacement(c *Cluster, aid appId) error {
 	app := m.app[aid]
-	dests := make([]nodeId, 0, len(app.dep[mid]))
-	for _, dep := range app.dep[mid] {
-		if nid := app.ms[dep.dmId].placeNode; nid != NotPlaced {
-			dests = append(dests, nid)
+	for _, ms := range app.ms {
+		if ms.replica != 0 || ms.minSpread <= 1 {
+			continue
+		}
+		if spread := c.spreadOf(app, ms.originId(), ms.spreadBy); spread < ms.minSpread {
+			return fmt.Errorf("replicas of ms %s spread across %d domains, less than %d", ms.id, spread, ms.minSpread)
 		}
 	}
+	for _, con := range app.constraints {
+		if !con.hard {
+			continue
+		}
+		for _, ms := range app.ms {
+			if app.violates(c, con, ms.id, ms.nextPlaceNode) {
+				return fmt.Errorf("ms %s on node %s violates constraint %v %s-%s", ms.id, ms.nextPlaceNode, con.kind, con.a, con.b)
+			}
+		}
+	}
+	if app.sloLatency > 0 {
+		lat := app.criticalPathLatency(c, app.nextPlacement)
+		if lat > app.sloLatency {
+			return &SLOError{app: aid, latency: lat, slo: app.sloLatency}
+		}
+	}
+	for _, member := range app.members { // 批量应用按各成员的时延 SLO 分别检查
+		if member.sloLatency <= 0 {
+			continue
+		}
+		if lat := member.criticalPathLatency(c, app.memberPlacement(member)); lat > member.sloLatency {
+			return &SLOError{app: member.id, latency: lat, slo: member.sloLatency}
+		}
+	}
+	return nil
+}
+
+func (m *MOTAS) getMinCost(c *Cluster, aid appId, mid msId, srcs []nodeId) (float32, nodeId, map[nodeId][]nodeId) {
+	dests := make([]nodeId, 0)
+	for _, t := range m.app[aid].trafficOf(mid, false) { // 已放置的下游微服务以及固定位置的上游微服务
+		dests = append(dests, t.peer)
+	}
 
 	var minSrc nodeId
 	var minCost float32 = math.MaxFloat32
 	var minCostPaths map[nodeId][]nodeId // dest node -> path of from src to dest
 	for _, src := range srcs {
-		cost, paths := m.cluster.minimalCostPath(src, dests)
+		cost, paths := c.minimalCostPath(src, dests)
 		if cost < minCost {
 			minSrc = src
 			minCost = cost
@@ -403,42 +608,73 @@ func (m *MOTAS) getMinCost(aid appId, mid msId, srcs []nodeId) (float32, nodeId,
 	return minCost, minSrc, minCostPaths
 }
 
-func (m *MOTAS) getInter(aid appId, mid msId, nid nodeId, path map[nodeId][]nodeId) float32 {
+// getInter 计算微服务放置在节点 nid 上时，其流量经过的链路所受到的网络干扰，
+// 路径无效时返回 *PathError，拒绝超额订阅链路时返回 *SaturationError
+func (m *MOTAS) getInter(c *Cluster, aid appId, mid msId, nid nodeId, path map[nodeId][]nodeId) (float32, error) {
+	// ms of mid -- call --> ms of t.dmId, or fixed ms of t.umId -- call --> ms of mid
+	return c.trafficInter(m.app[aid].trafficOf(mid, false), nid, path)
+}
+
+// trafficInter 计算从节点 nid 出发的流量 ts 沿路径 path 经过的链路所受到的网络干扰
+func (c *Cluster) trafficInter(ts []traffic, nid nodeId, path map[nodeId][]nodeId) (float32, error) {
 	var inter float32 = 0
-	links := m.cluster.links
-	app := m.app[aid]
-	for _, dep := range app.dep[mid] { // ms of mid -- call --> ms of dep.dmId
+	links := c.links
+	for _, t := range ts {
+		dest := t.peer
+		if dest == nid { // 同节点通信
+			li, err := c.colocationInter(nid, t.trans)
+			if err != nil {
+				return 0, err
+			}
+			inter += li
+			continue
+		}
+		p, ok := path[dest]
+		if !ok { // 目的节点不可达
+			return 0, &PathError{from: nid, to: dest}
+		}
 		var from nodeId
-		for i, to := range path[app.ms[dep.dmId].placeNode] {
+		for i, to := range p {
 			if i == 0 { // first node
 				from = to
 				continue
 			}
-			link := links[from][to]
-			inter += dep.trans / (link.bandCap - link.nextBandAlloc)
+			link, ok := links[from][to]
+			if !ok {
+				return 0, &PathError{from: from, to: to}
+			}
+			li, err := c.linkInter(link, t.trans)
+			if err != nil {
+				return 0, err
+			}
+			inter += li
 			from = to
 		}
 	}
 
-	return inter
+	return inter, nil
+}
+
+func (m *MOTAS) getFrag(c *Cluster, aid appId, mid msId, nid nodeId) float32 {
+	return c.fragWith(nid, m.app[aid].ms[mid].resReq)
 }
 
-func (m *MOTAS) getFrag(aid appId, mid msId, nid nodeId) float32 {
+// fragWith 计算在节点 nid 上再分配资源 req 后集群各节点资源碎片之和，nid 为 NotPlaced 时为集群当前的资源碎片
+func (c *Cluster) fragWith(nid nodeId, req map[ResourceType]Resource) float32 {
 	var (
-		ms           = m.app[aid].ms[mid]
 		frag float32 = 0 // final ret
 		gama float32
 		r    float32
 		f    float32
 	)
 
-	for _, node := range m.cluster.nodes {
+	for _, node := range c.nodes {
 		r = 0
 		for _, typ := range node.resType {
 			if node.id == nid {
-				gama = (node.nextAlloc[typ].value + ms.resReq[typ].value) / node.capa[typ].value
+				gama = (c.nextAllocOf(node, typ) + req[typ].value) / node.capa[typ].value
 			} else {
-				gama = node.nextAlloc[typ].value / node.capa[typ].value
+				gama = c.nextAllocOf(node, typ) / node.capa[typ].value
 			}
 			r += node.args[typ] * gama
 		}
@@ -447,9 +683,9 @@ func (m *MOTAS) getFrag(aid appId, mid msId, nid nodeId) float32 {
 		f = 0
 		for _, typ := range node.resType {
 			if node.id == nid {
-				gama = (node.nextAlloc[typ].value + ms.resReq[typ].value) / node.capa[typ].value
+				gama = (c.nextAllocOf(node, typ) + req[typ].value) / node.capa[typ].value
 			} else {
-				gama = node.nextAlloc[typ].value / node.capa[typ].value
+				gama = c.nextAllocOf(node, typ) / node.capa[typ].value
 			}
 
 			f += (gama - r) * (gama - r)
@@ -462,6 +698,24 @@ func (m *MOTAS) getFrag(aid appId, mid msId, nid nodeId) float32 {
 	return frag
 }
 
-func (m *MOTAS) score(cost, inter, frag float32) float32 {
-	return m.alphaC*cost + m.alphaI*inter + m.alphaF*frag
+// getLatency 计算微服务 mid 放置在节点 nid 上时应用的关键路径端到端时延
+func (m *MOTAS) getLatency(c *Cluster, aid appId, mid msId, nid nodeId) float32 {
+	app := m.app[aid]
+	return app.criticalPathLatency(c, c.branch.placement(app.placeWith(mid, nid)))
+}
+
+// getPenalty 计算微服务 mid 放置在节点 nid 上时违背软约束以及不容忍 PreferNoSchedule 污点的惩罚
+func (m *MOTAS) getPenalty(c *Cluster, aid appId, mid msId, nid nodeId) float32 {
+	app := m.app[aid]
+	penalty := TaintPenalty * float32(c.nodes[nid].untolerated(app.ms[mid]))
+	for _, con := range app.constraints {
+		if !con.hard && app.violates(c, con, mid, nid) {
+			penalty += con.weight
+		}
+	}
+	return penalty
+}
+
+func (m *MOTAS) score(cost, inter, frag, lat float32) float32 {
+	return m.alphaC*cost + m.alphaI*inter + m.alphaF*frag + m.alphaL*lat
 }
@@ -23,12 +23,164 @@ func TestMOTAS(t *testing.T) {
 	app := newTestService(resReq, BandReq)
 	cluster := newTestCluster(resType, resCPU, resMem, brand)
 	mts := NewMOTAS(cluster)
-	mts.AddTask(app)
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
 	time.Sleep(5 * time.Second)
 	mts.Kill()
 	time.Sleep(2 * time.Second)
 }
 
+func TestReplicaSpread(t *testing.T) {
+	app := newTestService(resReq, BandReq)
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	mts := newTestMOTAS(cluster, app)
+	app.ms["A"].replicas = 3
+	app.ms["A"].minSpread = 3
+	app.expandReplicas()
+	fmt.Println("ms count after expanding replicas:", app.msCount())
+	if app.msCount() != 8 || len(app.dep["A#2"]) != 2 || app.dep["A#2"][0].trans != BandReq/3 {
+		t.Fatalf("unexpected replica expansion")
+	}
+
+	ms2node, err := mts.schedule(app.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(app.id, ms2node)
+	for key, nid := range app.replicaPlacement() {
+		fmt.Printf("(%s, %d) -> %s\n", key.ms, key.replica, nid)
+	}
+	if spread := cluster.spreadOf(app, "A", SpreadNode); spread < 3 {
+		t.Fatalf("expect replicas of A to spread across 3 nodes, got %d", spread)
+	}
+}
+
+func TestPinnedAndExternal(t *testing.T) {
+	app := newTestService(resReq, BandReq)
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	mts := newTestMOTAS(cluster, app)
+	// D is a managed database outside the cluster, reached through node2
+	cluster.links["node2"]["ext-db"] = &Link{from: "node2", to: "ext-db", cost: 1, bandCap: 4 * brand}
+	cluster.links["ext-db"] = map[nodeId]*Link{"node2": {from: "ext-db", to: "node2", cost: 1, bandCap: 4 * brand}}
+	app.ms["D"].pinNode, app.ms["D"].external = "ext-db", true
+	app.ms["E"].pinNode = "node1"
+
+	mss := app.schedulable()
+	if _, ok := mss["D"]; ok || len(mss) != 4 {
+		t.Fatalf("expect pinned and external ms not to be partitioned")
+	}
+	ms2node, err := mts.schedule(app.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(app.id, ms2node)
+	for mid, ms := range app.ms {
+		fmt.Printf("%s -> %s\n", mid, ms.placeNode)
+	}
+	if app.ms["D"].placeNode != "ext-db" || app.ms["E"].placeNode != "node1" {
+		t.Fatalf("expect pinned ms to stay at their fixed location")
+	}
+	if app.ms["B"].placeNode != "node2" || app.ms["C"].placeNode != "node2" {
+		t.Fatalf("expect the callers of the external database to be pulled to its gateway")
+	}
+	if cluster.nodes["node1"].alloc[ResCPU].value < resReq[ResCPU].value {
+		t.Fatalf("expect resources of the pinned ms to be reserved")
+	}
+	fmt.Println("band alloc node2 -> ext-db:", cluster.links["node2"]["ext-db"].bandAlloc)
+	if cluster.links["node2"]["ext-db"].bandAlloc != 2*BandReq {
+		t.Fatalf("expect traffic to the external database to be reserved")
+	}
+}
+
+func TestIngress(t *testing.T) {
+	app := newTestService(resReq, BandReq)
+	cluster := newTestCluster(resType, 2*resCPU, 2*resMem, 4*brand)
+	mts := newTestMOTAS(cluster, app)
+	app.ingress = []*Ingress{{gateway: "node3", trans: 20 * MB}}
+
+	cost0, _, _ := mts.getMinCost(cluster, app.id, "A", []nodeId{"node0"})
+	cost3, _, _ := mts.getMinCost(cluster, app.id, "A", []nodeId{"node3"})
+	fmt.Println("cost of A on node0:", cost0, "on node3:", cost3)
+	if cost0 <= cost3 {
+		t.Fatalf("expect the gateway to pull the root ms")
+	}
+
+	ms2node, err := mts.schedule(app.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(app.id, ms2node)
+	fmt.Println("A ->", app.ms["A"].placeNode)
+	if app.ms["A"].placeNode != "node3" {
+		t.Fatalf("expect the root ms to be placed at its gateway, got %s", app.ms["A"].placeNode)
+	}
+	if cluster.links["node3"]["node3"].bandAlloc < 20*MB {
+		t.Fatalf("expect the ingress traffic to be reserved")
+	}
+}
+
+func TestGetInterSaturation(t *testing.T) {
+	app := newTestService(resReq, BandReq)
+	cluster := newTestCluster(resType, resCPU, resMem, brand).begin()
+	mts := newTestMOTAS(cluster, app)
+	app.ms["B"].placeNode = "node1"
+	app.ms["C"].placeNode = "node0"
+
+	_, path := cluster.minimalCostPath("node0", []nodeId{"node1", "node0"})
+	inter, err := mts.getInter(cluster, app.id, "A", "node0", path)
+	fmt.Println("idle link inter:", inter, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Println("fill the link between node0 and node1")
+	cluster.incNextBandAlloc("node0", "node1", brand)
+	inter, err = mts.getInter(cluster, app.id, "A", "node0", path)
+	fmt.Println("saturated link inter (penalty):", inter, err)
+	if err != nil || inter < DefaultSaturationPenalty {
+		t.Fatalf("expect a saturation penalty, got inter=%v, err=%v", inter, err)
+	}
+
+	cluster.SetSaturation(SaturationReject, 0)
+	_, err = mts.getInter(cluster, app.id, "A", "node0", path)
+	fmt.Println("saturated link inter (reject):", err)
+	if _, ok := err.(*SaturationError); !ok {
+		t.Fatalf("expect *SaturationError, got %v", err)
+	}
+
+	delete(cluster.links["node0"], "node1")
+	_, err = mts.getInter(cluster, app.id, "A", "node0", path)
+	fmt.Println("missing link:", err)
+	if _, ok := err.(*PathError); !ok {
+		t.Fatalf("expect *PathError, got %v", err)
+	}
+}
+
+func TestPinnedSaturation(t *testing.T) {
+	app := newTestService(resReq, BandReq)
+	app.ms["A"].pinNode, app.ms["B"].pinNode = "node0", "node1"
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	cluster.links["node0"]["node1"].bandCap = BandReq / 2
+	cluster.links["node1"]["node0"].bandCap = BandReq / 2
+	cluster.SetSaturation(SaturationReject, 0)
+	mts := newTestMOTAS(cluster, app)
+
+	_, err := mts.schedule(app.id)
+	fmt.Println("pinned A -> B over a narrow link:", err)
+	if _, ok := err.(*SaturationError); !ok {
+		t.Fatalf("expect *SaturationError, got %v", err)
+	}
+	if band := cluster.links["node0"]["node1"].bandAlloc; band != 0 {
+		t.Fatalf("expect no bandwidth to be reserved, got %.2f", band)
+	}
+
+	cluster.SetSaturation(SaturationPenalty, 0) // 超额订阅只带来干扰惩罚
+	if _, err := mts.schedule(app.id); err != nil {
+		t.Fatalf("expect the pinned traffic to be admitted under the penalty policy, got %v", err)
+	}
+}
+
 func TestMsQueue(t *testing.T) {
 	// priority: 3(5) > 5(4) > 2(3) > 4(2) > 1(1)
 	apps := []*Service{
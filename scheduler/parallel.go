@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"runtime"
+	"sync"
+)
+
+// branch 并行递归中一个分支看到的放置情况：分支内的微服务读取实时预放置节点，其他微服务读取分叉时的快照，
+// 避免读取另一个分支正在写入的预放置节点
+type branch struct {
+	own    map[msId]*Microservice
+	frozen map[msId]nodeId
+}
+
+// placement 返回分支视角下的放置函数，b 为 nil（没有分叉）时直接使用 place
+func (b *branch) placement(place func(msId) nodeId) func(msId) nodeId {
+	if b == nil {
+		return place
+	}
+	return func(id msId) nodeId {
+		if _, ok := b.own[id]; ok {
+			return place(id)
+		}
+		if nid, ok := b.frozen[id]; ok {
+			return nid
+		}
+		return NotPlaced
+	}
+}
+
+// independent 判断划分后的两组微服务能否并行映射：两组之间没有调用关系、没有约束关联、没有同一微服务的副本，
+// 且应用没有时延 SLO（SLO 过滤依赖整个应用的放置）
+func (s *Service) independent(mss0, mss1 map[msId]*Microservice) bool {
+	if len(mss0) == 0 || len(mss1) == 0 || s.sloLatency > 0 {
+		return false
+	}
+	origins0 := make(map[msId]bool)
+	for mid, ms := range mss0 {
+		origins0[ms.originId()] = true
+		for _, dep := range s.dep[mid] {
+			if _, ok := mss1[dep.dmId]; ok {
+				return false
+			}
+		}
+		for _, dep := range s.reDep[mid] {
+			if _, ok := mss1[dep.umId]; ok {
+				return false
+			}
+		}
+	}
+	origins1 := make(map[msId]bool)
+	for _, ms := range mss1 {
+		if origins0[ms.originId()] {
+			return false
+		}
+		origins1[ms.originId()] = true
+	}
+	for _, con := range s.constraints {
+		if (origins0[con.a] && origins1[con.b]) || (origins1[con.a] && origins0[con.b]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unsettle 清除微服务的位置已确定标记
+func (s *Service) unsettle(mss map[msId]*Microservice) {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+	for mid := range mss {
+		delete(s.settled, mid)
+	}
+}
+
+// tryAcquire 尝试占用一个并行递归名额，名额用完时返回 false 并顺序执行
+func tryAcquire(sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetPartitionWorkers 设置并行递归映射子问题的最大并发数，n <= 0 时取 CPU 核数
+func (m *MOTAS) SetPartitionWorkers(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	m.forkSem = make(chan struct{}, n)
+}
+
+// mapParallel 并行递归映射两个独立的子问题，各自在子事务中预分配，完成后依次合并到 cluster 的事务中。
+// 两个分支共同预分配的链路（如访问同一外部端点）合并后超出容量时，放弃 c1 分支并在合并后的状态上顺序重做
+func (m *MOTAS) mapParallel(aid appId, mss0, mss1 map[msId]*Microservice, cluster, c0, c1 *Cluster) (
+	map[msId]nodeId, map[msId]nodeId, error) {
+
+	app := m.app[aid]
+	place := cluster.branch.placement(app.nextPlacement)
+	frozen := make(map[msId]nodeId, len(app.ms))
+	for mid := range app.ms {
+		frozen[mid] = place(mid)
+	}
+	b0, b1 := c0.begin(), c1.begin()
+	b0.branch = &branch{own: mss0, frozen: frozen}
+	b1.branch = &branch{own: mss1, frozen: frozen}
+
+	DLogINFO("app(id=%s) maps %d and %d microservices in parallel", aid, len(mss0), len(mss1))
+	var (
+		wg       sync.WaitGroup
+		ms2node0 map[msId]nodeId
+		ms2node1 map[msId]nodeId
+		err0     error
+		err1     error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ms2node0, err0 = m.recursiveMapping(aid, mss0, b0) // 递归处理 c0 分区
+	}()
+	ms2node1, err1 = m.recursiveMapping(aid, mss1, b1) // 递归处理 c1 分区
+	wg.Wait()
+	if err0 != nil {
+		return nil, nil, err0
+	}
+	if err1 != nil {
+		return nil, nil, err1
+	}
+
+	b0.commit()
+	if err := b1.tx.validate(); err != nil {
+		DLogINFO("app(id=%s) remaps the right partition sequentially: %v", aid, err)
+		app.unsettle(mss1)
+		ms2node1, err1 = m.recursiveMapping(aid, mss1, c1)
+		return ms2node0, ms2node1, err1
+	}
+	b1.commit()
+	return ms2node0, ms2node1, nil
+}
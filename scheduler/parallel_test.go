@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newTestComponents 构造由 n 个互不调用的调用链 Xi -> Yi 组成的应用
+func newTestComponents(n int, resReq map[ResourceType]Resource, bandReq float32) *Service {
+	app := &Service{
+		id:     "components",
+		rootId: "X0",
+		ms:     make(map[msId]*Microservice),
+		dep:    make(map[msId][]*Dependence),
+		reDep:  make(map[msId][]*Dependence),
+	}
+	for i := 0; i < n; i++ {
+		x, y := msId(fmt.Sprintf("X%d", i)), msId(fmt.Sprintf("Y%d", i))
+		for _, mid := range []msId{x, y} {
+			app.ms[mid] = &Microservice{id: mid, resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced}
+		}
+		dep := &Dependence{umId: x, dmId: y, trans: bandReq}
+		app.dep[x] = append(app.dep[x], dep)
+		app.reDep[y] = append(app.reDep[y], dep)
+	}
+	return app
+}
+
+func TestIndependent(t *testing.T) {
+	app := newTestComponents(2, resReq, BandReq)
+	side := func(ids ...msId) map[msId]*Microservice {
+		ret := make(map[msId]*Microservice)
+		for _, id := range ids {
+			ret[id] = app.ms[id]
+		}
+		return ret
+	}
+	if !app.independent(side("X0", "Y0"), side("X1", "Y1")) {
+		t.Fatalf("expect components to be independent")
+	}
+	if app.independent(side("X0"), side("Y0", "X1", "Y1")) {
+		t.Fatalf("expect a call across the sides to make them dependent")
+	}
+	app.constraints = []*Constraint{{kind: AntiAffinity, scope: SpreadNode, a: "X0", b: "X1", hard: true}}
+	if app.independent(side("X0", "Y0"), side("X1", "Y1")) {
+		t.Fatalf("expect a constraint across the sides to make them dependent")
+	}
+}
+
+func TestParallelRecursiveMapping(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	quarter := map[ResourceType]Resource{ResCPU: {ResCPU, resCPU / 4}, ResMem: {ResMem, resMem / 4}}
+	app := newTestComponents(4, quarter, 4*BandReq)
+	mts := newTestMOTAS(cluster, app)
+	mts.SetPartitionWorkers(4)
+
+	ms2node, err := mts.schedule(app.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(app.id, ms2node)
+	for mid, nid := range ms2node {
+		fmt.Printf("%s -> %s\n", mid, nid)
+	}
+	if len(ms2node) != 8 {
+		t.Fatalf("expect every microservice to be mapped, got %v", ms2node)
+	}
+	checkCommitted(t, mts)
+}
+
+func TestParallelSharedLink(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	quarter := map[ResourceType]Resource{ResCPU: {ResCPU, resCPU / 4}, ResMem: {ResMem, resMem / 4}}
+	app := newTestComponents(4, quarter, BandReq)
+	// 所有调用链都访问经 node0 到达的外部端点，链路只能容纳一半的流量
+	for from := range cluster.nodes {
+		cluster.links[from]["ext"] = &Link{from: from, to: "ext", cost: 1, bandCap: 2 * BandReq}
+	}
+	app.ms["ext"] = &Microservice{id: "ext", pinNode: "ext", external: true, placeNode: NotPlaced, nextPlaceNode: NotPlaced}
+	for i := 0; i < 4; i++ {
+		y := msId(fmt.Sprintf("Y%d", i))
+		dep := &Dependence{umId: y, dmId: "ext", trans: BandReq}
+		app.dep[y] = append(app.dep[y], dep)
+		app.reDep["ext"] = append(app.reDep["ext"], dep)
+	}
+	mts := newTestMOTAS(cluster, app)
+	mts.SetPartitionWorkers(4)
+
+	ms2node, err := mts.schedule(app.id)
+	fmt.Println("mapping:", ms2node, "err:", err)
+	if err != nil {
+		return // 链路带宽不足时调度失败，不能超额预分配
+	}
+	mts.doPlacement(app.id, ms2node)
+	for from := range cluster.nodes {
+		if link := cluster.links[from]["ext"]; link.bandAlloc > link.bandCap {
+			t.Fatalf("link %s -> ext is overcommitted: %.2f/%.2f", from, link.bandAlloc, link.bandCap)
+		}
+	}
+	checkCommitted(t, mts)
+}
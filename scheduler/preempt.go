@@ -0,0 +1,248 @@
+package scheduler
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Preemption 抢占记录：高优先级应用无法放置时，驱逐低优先级已放置应用使其能够放置。
+// 不超过 PreemptSearchSize 个驱逐对象时按集合大小穷举，驱逐对象最少；更大的集合贪心求得，不保证最少
+type Preemption struct {
+	app     appId
+	victims []appId
+	minimal bool // whether victims is a minimum set, false if it is found greedily and may be larger than needed
+	at      time.Time
+}
+
+// Preemptions 返回所有抢占记录
+func (m *MOTAS) Preemptions() []*Preemption {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ret := make([]*Preemption, len(m.preemptions))
+	copy(ret, m.preemptions)
+	return ret
+}
+
+// preempt 为无法放置的应用寻找低优先级已放置应用集合（驱逐对象），资源和链路带宽都计入是否能够放置的判断。
+// 先按集合大小从 1 到 PreemptSearchSize 穷举，大小相同时优先驱逐优先级更低的应用，找到的集合即为最少的驱逐对象；
+// 都无法放置时按优先级从低到高逐个加入驱逐对象直到能够放置，再去掉不必要的驱逐对象，此时去掉任何一个都无法放置，但不保证最少。
+// 找到时回收驱逐对象占用的资源并完成该应用的预放置，返回驱逐对象和映射关系，集群保留预分配状态等待提交
+func (m *MOTAS) preempt(aid appId) ([]appId, map[msId]nodeId, error) {
+	app := m.app[aid]
+	candidates := make([]*Service, 0)
+	for _, a := range m.app {
+		if a.id != aid && a.placed && a.priority < app.priority && !app.calls(a.id) { // 不驱逐应用调用的其他应用
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil, errors.New("no lower-priority app to preempt")
+	}
+	sort.Slice(candidates, func(i, j int) bool { // 优先驱逐优先级更低的应用
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].id < candidates[j].id
+	})
+
+	victims := m.searchVictims(aid, candidates)
+	// 贪心：按优先级从低到高逐个加入驱逐对象直到能够放置，再去掉不必要的驱逐对象
+	if victims == nil {
+		fit := false
+		for _, c := range candidates {
+			victims = append(victims, c.id)
+			if fit = m.fitsWithout(aid, victims); fit {
+				break
+			}
+		}
+		if !fit {
+			return nil, nil, errors.New("out of resources even if all lower-priority apps are preempted")
+		}
+		for i := len(victims) - 1; i >= 0 && len(victims) > 1; i-- {
+			rest := make([]appId, 0, len(victims)-1)
+			rest = append(rest, victims[:i]...)
+			rest = append(rest, victims[i+1:]...)
+			if m.fitsWithout(aid, rest) {
+				victims = rest
+			}
+		}
+	}
+
+	c := m.cluster.begin()
+	m.releaseApps(c, victims...)
+	ms2node, err := m.scheduleOn(c, aid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return victims, ms2node, nil
+}
+
+// searchVictims 按集合大小从 1 到 PreemptSearchSize 穷举驱逐对象，返回最先使应用能够放置的集合，没有时返回 nil。
+// candidates 按优先级从低到高排序，大小相同的集合按字典序枚举
+func (m *MOTAS) searchVictims(aid appId, candidates []*Service) []appId {
+	for k := 1; k <= PreemptSearchSize && k <= len(candidates); k++ {
+		idx := make([]int, k)
+		for i := range idx {
+			idx[i] = i
+		}
+		for {
+			victims := make([]appId, k)
+			for i, j := range idx {
+				victims[i] = candidates[j].id
+			}
+			if m.fitsWithout(aid, victims) {
+				return victims
+			}
+			// 下一个组合
+			i := k - 1
+			for i >= 0 && idx[i] == len(candidates)-k+i {
+				i--
+			}
+			if i < 0 {
+				break
+			}
+			idx[i]++
+			for j := i + 1; j < k; j++ {
+				idx[j] = idx[j-1] + 1
+			}
+		}
+	}
+	return nil
+}
+
+// fitsWithout 判断回收 victims 占用的资源后应用能否放置，判断结束后放弃事务
+func (m *MOTAS) fitsWithout(aid appId, victims []appId) bool {
+	c := m.cluster.begin()
+	m.releaseApps(c, victims...)
+	_, err := m.scheduleOn(c, aid)
+	m.app[aid].rollbackPlaceStat()
+	return err == nil
+}
+
+// releaseApps 按已放置位置在事务视图 c 中回收应用占用的节点资源和链路带宽，以及与这些应用相关的跨应用调用的链路带宽，提交后生效
+func (m *MOTAS) releaseApps(c *Cluster, aids ...appId) {
+	released := make(map[appId]bool, len(aids))
+	for _, aid := range aids {
+		released[aid] = true
+		m.releaseApp(c, aid)
+	}
+	for _, app := range m.app { // 每个跨应用调用只回收一次
+		for _, call := range app.crossCalls {
+			if released[app.id] || released[call.dmApp] {
+				c.decNextBandAlloc(call.from, call.to, call.trans)
+			}
+		}
+	}
+}
+
+// releaseApp 按已放置位置在事务视图 c 中回收应用自身占用的节点资源和链路带宽
+func (m *MOTAS) releaseApp(c *Cluster, aid appId) {
+	app := m.app[aid]
+	touched := make(map[nodeId]bool)
+	for _, ms := range app.ms {
+		if ms.placeNode == NotPlaced {
+			continue
+		}
+		if !ms.external {
+			c.decAllNextAlloc(ms.placeNode, ms.resReq)
+			touched[ms.placeNode] = true
+		}
+		for _, t := range app.ingressOf(ms.id) {
+			c.decNextBandAlloc(ms.placeNode, t.peer, t.trans)
+		}
+	}
+	for _, deps := range app.dep { // 每条调用关系按两端最终位置预分配过一次
+		for _, dep := range deps {
+			c.decNextBandAlloc(app.ms[dep.umId].placeNode, app.ms[dep.dmId].placeNode, dep.trans)
+		}
+	}
+	for nid := range touched {
+		c.updateNextGama(nid)
+	}
+}
+
+// victimState 映射时驱逐对象的放置状态，事务中按此回收其资源和链路带宽，提交前与当前状态比较
+type victimState struct {
+	app   *Service
+	nodes map[msId]nodeId
+	req   map[msId]map[ResourceType]Resource
+	calls map[crossCall]int // cross-app calls of or to the victim
+}
+
+// victimStateOf 返回驱逐对象当前的放置状态，应用不存在或未放置时返回 nil，调用者需持有 m.mu（读锁即可）
+func (m *MOTAS) victimStateOf(vid appId) *victimState {
+	app, ok := m.app[vid]
+	if !ok || !app.placed {
+		return nil
+	}
+	ret := &victimState{
+		app:   app,
+		nodes: make(map[msId]nodeId, len(app.ms)),
+		req:   make(map[msId]map[ResourceType]Resource, len(app.ms)),
+		calls: make(map[crossCall]int),
+	}
+	for mid, ms := range app.ms {
+		ret.nodes[mid] = ms.placeNode
+		ret.req[mid] = ms.resReq
+	}
+	for _, a := range m.app {
+		for _, call := range a.crossCalls {
+			if a.id == vid || call.dmApp == vid {
+				ret.calls[call]++
+			}
+		}
+	}
+	return ret
+}
+
+// same 判断两个放置状态是否一致：同一个应用描述，微服务位置、申请的资源以及相关的跨应用调用都不变
+func (s *victimState) same(o *victimState) bool {
+	if s == nil || o == nil || s.app != o.app || len(s.nodes) != len(o.nodes) || len(s.calls) != len(o.calls) {
+		return false
+	}
+	for mid, nid := range s.nodes {
+		if o.nodes[mid] != nid || !sameRes(s.req[mid], o.req[mid]) {
+			return false
+		}
+	}
+	for call, n := range s.calls {
+		if o.calls[call] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRes 判断两组资源申请是否相同
+func sameRes(a, b map[ResourceType]Resource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for typ, r := range a {
+		if b[typ] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// evict 驱逐已被回收资源的应用，将其重新放入调度队列并记录抢占，调用者需持有 m.mu
+func (m *MOTAS) evict(aid appId, victims []appId) {
+	for _, vid := range victims {
+		victim := m.app[vid]
+		for _, ms := range victim.ms {
+			ms.placeNode, ms.nextPlaceNode = NotPlaced, NotPlaced
+		}
+		victim.placed = false
+		m.scheduleQ.push(victim)
+		DLogINFO("⚠️ app(id=%s) is preempted by app(id=%s) and re-enters the queue", vid, aid)
+	}
+	for _, vid := range victims {
+		m.dropCrossCalls(vid)
+		m.unreserve(m.app[vid])
+	}
+	// 不超过 PreemptSearchSize 的集合已穷举，贪心求得的集合恰好多一个时也是最少的
+	minimal := len(victims) <= PreemptSearchSize+1
+	m.preemptions = append(m.preemptions, &Preemption{app: aid, victims: victims, minimal: minimal, at: time.Now()})
+}
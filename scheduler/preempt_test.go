@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPreempt(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	low1 := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 3}, ResMem: {ResMem, 25 * MB}}, BandReq)
+	low1.id, low1.priority = "low1", 2
+	low2 := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	low2.id, low2.priority = "low2", 1
+	high := newTestService(resReq, BandReq)
+	high.id, high.priority = "high", 10
+	mts := newTestMOTAS(cluster, low1, low2, high)
+
+	for _, app := range []*Service{low1, low2} {
+		ms2node, err := mts.schedule(app.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mts.doPlacement(app.id, ms2node)
+	}
+	if _, err := mts.schedule(high.id); err == nil {
+		t.Fatalf("expect app high not to fit before preemption")
+	}
+
+	victims, ms2node, err := mts.preempt(high.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(high.id, ms2node)
+	mts.evict(high.id, victims)
+	fmt.Println("victims:", victims)
+	if len(victims) != 1 {
+		t.Fatalf("expect exactly one victim, got %v", victims)
+	}
+	for _, vid := range victims {
+		if mts.app[vid].placed || mts.app[vid].priority >= high.priority {
+			t.Fatalf("unexpected victim %s", vid)
+		}
+	}
+	if len(mts.Preemptions()) != 1 || mts.scheduleQ.empty() {
+		t.Fatalf("expect the preemption to be recorded and the victim to be re-enqueued")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestPreemptMinimumSet(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	single := func(id appId, priority int, cpu float32) *Service {
+		return &Service{
+			id:       id,
+			rootId:   "A",
+			priority: priority,
+			ms: map[msId]*Microservice{"A": {
+				id:            "A",
+				resReq:        map[ResourceType]Resource{ResCPU: {ResCPU, cpu}, ResMem: {ResMem, cpu * 15 * MB}},
+				placeNode:     NotPlaced,
+				nextPlaceNode: NotPlaced,
+				pinNode:       "node0",
+			}},
+			dep:   map[msId][]*Dependence{},
+			reDep: map[msId][]*Dependence{},
+		}
+	}
+	low1, low2, low3 := single("low1", 1, 2), single("low2", 2, 2), single("low3", 3, 4)
+	high := single("high", 10, 6)
+	mts := newTestMOTAS(cluster, low1, low2, low3, high)
+	for _, app := range []*Service{low1, low2, low3} {
+		placeApp(t, mts, app.id)
+	}
+
+	victims, ms2node, err := mts.preempt(high.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mts.doPlacement(high.id, ms2node)
+	mts.evict(high.id, victims)
+	fmt.Println("victims:", victims)
+	if len(victims) != 2 || victims[0] != "low1" || victims[1] != "low3" {
+		t.Fatalf("expect the smallest set with the lowest priorities, got %v", victims)
+	}
+	if p := mts.Preemptions()[0]; !p.minimal {
+		t.Fatalf("expect the preemption to be recorded as minimal")
+	}
+	checkCommitted(t, mts)
+}
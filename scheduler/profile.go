@@ -2,7 +2,10 @@ package scheduler
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"sync"
+	"time"
 	
 	"github.com/jinzhu/copier"
 
@@ -21,6 +24,32 @@ type Service struct {
 	levelOrder    []msId                 // order of level travel
 	topologyOrder []msId                 // order of topology from callee to caller
 	priority      int
+	sloLatency    float32                // end-to-end latency SLO of the critical path, 0 means no SLO
+	constraints   []*Constraint          // affinity and anti-affinity constraints between microservices
+	ingress       []*Ingress             // user traffic entering the root microservice
+	placed        bool                   // whether the app has been placed on the cluster
+	settled       map[msId]bool          // microservices whose node is final in the current scheduling attempt
+	attempts      int                    // failed scheduling attempts
+	notBefore     time.Time              // the app is not schedulable before this time (backoff)
+	removed       bool                   // the app has been removed and is dropped when dequeued
+	gen           uint64                 // incremented on removal, attempts mapped before the removal are dropped
+	tenant        string                 // owner of the app, used by fair queuing across tenants
+	enqueuedAt    time.Time              // when the app entered the scheduling queue, used by aging
+	reserved      *resUsage              // resources and bandwidth counted in the tenant usage while placed
+	heldUsage     map[string]*resUsage   // tenant -> usage that went over the quota while the app is held
+	tx            *txn                   // reservations of the successful scheduling attempt, committed on placement
+	settleMu      sync.Mutex             // guards settled when sub-problems are mapped in parallel
+	remoteDep     map[msId][]*Dependence // um -> dm list in other apps
+	crossCalls    []crossCall            // calls to other apps whose bandwidth is reserved while both apps are placed
+	members       []*Service             // apps placed atomically together when the service is a batch
+	remote        map[msId][]crossCall   // calls to placed apps, resolved in the current scheduling attempt
+}
+
+// Ingress 从网关节点（如负载均衡器所在节点）进入根微服务的用户流量
+type Ingress struct {
+	gateway nodeId
+	trans   float32
+	root    msId // microservice the traffic enters, empty means the root microservice
 }
 
 type Microservice struct {
@@ -28,22 +57,81 @@ type Microservice struct {
 	resReq        map[ResourceType]Resource
 	placeNode     nodeId
 	nextPlaceNode nodeId
+	replicas      int               // replica count, 0 is regarded as 1
+	minSpread     int               // min number of nodes (or zones) that the replicas spread across
+	spreadBy      SpreadLevel       // spread replicas across nodes or zones
+	origin        msId              // id of the microservice which the replica belongs to, set when expanding replicas
+	replica       int               // index of the replica
+	nodeSelector  map[string]string // labels that the node must have
+	tolerations   []Toleration      // taints of the node that the microservice tolerates
+	pinNode       nodeId            // node (or endpoint outside the cluster) the microservice is pinned to, empty means not pinned
+	external      bool              // the microservice is an endpoint outside the cluster and consumes no node resource
+}
+
+// traffic 微服务与一个已放置对端之间的流量
+type traffic struct {
+	umId  msId
+	dmId  msId
+	peer  nodeId // node of the peer
+	trans float32
+}
+
+// Constraint 微服务之间的亲和/反亲和约束，约束作用于两个微服务的所有副本之间，
+// 硬约束在过滤节点时强制满足，软约束在违背时按 weight 惩罚效用值
+type Constraint struct {
+	kind   ConstraintKind
+	scope  SpreadLevel // share (or not share) a node or a zone
+	a      msId
+	b      msId
+	hard   bool
+	weight float32 // penalty of violating a soft constraint
+}
+
+// ConstraintKind 约束类型
+type ConstraintKind uint
+
+// replicaKey 微服务副本标识
+type replicaKey struct {
+	ms      msId
+	replica int
 }
 
+// SpreadLevel 副本打散的拓扑层级
+type SpreadLevel uint
+
 type Dependence struct {
 	umId  msId
 	dmId  msId
 	trans float32
+	calls float32 // calls to dm per request of um, 0 is regarded as 1
+	dmApp appId   // app of dm when the call goes to another app, empty means the same app
 }
 
 func (s *Service) msCount() int {
 	return len(s.ms)
 }
 
+// callCount 每次请求中上游对下游的调用次数
+func (d *Dependence) callCount() float32 {
+	if d.calls <= 0 {
+		return 1
+	}
+	return d.calls
+}
+
 func (s *Service) decPriority() {
 	s.priority--
 }
 
+// readmit 清除已移除的应用上一次的调度状态，应用重新添加后按新应用调度
+func (s *Service) readmit() {
+	s.removed = false
+	s.attempts = 0
+	s.notBefore = time.Time{}
+	s.enqueuedAt = time.Time{}
+	s.heldUsage = nil
+}
+
 func (s *Service) getTopologyOrder() []msId {
 	if s.topologyOrder == nil || len(s.topologyOrder) != s.msCount() {
 		s.topologyOrder = s.topologyTravel()
@@ -66,6 +154,11 @@ func (s *Service) topologyTravel() []msId {
 			inDegree[dep.umId]++
 		}
 	}
+	for id := range s.ms { // 没有任何调用关系的微服务
+		if _, ok := inDegree[id]; !ok {
+			inDegree[id] = 0
+		}
+	}
 	q := util.NewQueue(s.msCount())
 	for id, in := range inDegree {
 		if in == 0 {
@@ -111,6 +204,285 @@ func (s *Service) levelTravel() []msId {
 	return order
 }
 
+// criticalPathLatency 计算从根微服务出发、沿调用关系的关键路径端到端时延，place 给出微服务所在节点，
+// 未放置的微服务与其他微服务之间的网络时延计为 0
+func (s *Service) criticalPathLatency(c *Cluster, place func(mid msId) nodeId) float32 {
+	memo := make(map[msId]float32)
+	visiting := make(map[msId]bool)
+	var travel func(mid msId) float32
+	travel = func(mid msId) float32 {
+		if lat, ok := memo[mid]; ok {
+			return lat
+		}
+		if visiting[mid] { // 调用成环
+			return 0
+		}
+		visiting[mid] = true
+		var maxLat float32 = 0
+		for _, dep := range s.dep[mid] { // 串行调用 calls 次，每次都需经过网络并等待下游返回
+			lat := dep.callCount() * (c.routeLatency(place(mid), place(dep.dmId)) + travel(dep.dmId))
+			if lat > maxLat {
+				maxLat = lat
+			}
+		}
+		visiting[mid] = false
+		memo[mid] = maxLat
+		return maxLat
+	}
+	return travel(s.rootId)
+}
+
+// placeWith 返回以预放置节点为准，并假设微服务 mid 放置在 nid 上的放置函数
+func (s *Service) placeWith(mid msId, nid nodeId) func(msId) nodeId {
+	return func(id msId) nodeId {
+		if id == mid {
+			return nid
+		}
+		return s.nextPlacement(id)
+	}
+}
+
+// nextPlacement 微服务的预放置节点
+func (s *Service) nextPlacement(mid msId) nodeId {
+	if ms, ok := s.ms[mid]; ok {
+		return ms.nextPlaceNode
+	}
+	return NotPlaced
+}
+
+// originId 副本所属微服务的 id
+func (ms *Microservice) originId() msId {
+	if ms.origin == "" {
+		return ms.id
+	}
+	return ms.origin
+}
+
+// fixed 微服务是否固定位置（固定到节点或为集群外部端点），固定位置的微服务不参与划分
+func (ms *Microservice) fixed() bool {
+	return ms.pinNode != ""
+}
+
+// nodeOf 微服务的放置节点，next 为 true 时返回预放置节点
+func (ms *Microservice) nodeOf(next bool) nodeId {
+	if next {
+		return ms.nextPlaceNode
+	}
+	return ms.placeNode
+}
+
+// replicaCount 副本数
+func (ms *Microservice) replicaCount() int {
+	if ms.replicas <= 1 {
+		return 1
+	}
+	return ms.replicas
+}
+
+func replicaIdOf(origin msId, idx int) msId {
+	if idx == 0 { // 第 0 个副本沿用微服务 id
+		return origin
+	}
+	return msId(fmt.Sprintf("%s#%d", origin, idx))
+}
+
+// expandReplicas 将多副本微服务展开为多个微服务实例，每一个副本都通过递归映射放置，
+// 原调用关系的流量在上下游副本之间均分：trans(u_i -> d_j) = trans(u -> d) / (replicas(u) * replicas(d))
+func (s *Service) expandReplicas() {
+	expanded := false
+	for _, ms := range s.ms {
+		if ms.origin != "" { // 已展开
+			continue
+		}
+		ms.origin = ms.id
+		for i := 1; i < ms.replicaCount(); i++ {
+			rid := replicaIdOf(ms.id, i)
+			s.ms[rid] = &Microservice{
+				id:            rid,
+				resReq:        ms.resReq,
+				placeNode:     NotPlaced,
+				nextPlaceNode: NotPlaced,
+				replicas:      ms.replicas,
+				minSpread:     ms.minSpread,
+				spreadBy:      ms.spreadBy,
+				origin:        ms.id,
+				replica:       i,
+				nodeSelector:  ms.nodeSelector,
+				tolerations:   ms.tolerations,
+				pinNode:       ms.pinNode,
+				external:      ms.external,
+			}
+			expanded = true
+		}
+	}
+	if !expanded {
+		return
+	}
+
+	dep := make(map[msId][]*Dependence)
+	reDep := make(map[msId][]*Dependence)
+	for _, deps := range s.dep {
+		for _, d := range deps {
+			if s.ms[d.umId].replica != 0 || s.ms[d.dmId].replica != 0 { // 只按原始调用关系展开
+				continue
+			}
+			nu, nd := s.ms[d.umId].replicaCount(), s.ms[d.dmId].replicaCount()
+			for i := 0; i < nu; i++ {
+				for j := 0; j < nd; j++ {
+					rd := &Dependence{
+						umId:  replicaIdOf(d.umId, i),
+						dmId:  replicaIdOf(d.dmId, j),
+						trans: d.trans / float32(nu*nd),
+						calls: d.calls,
+					}
+					dep[rd.umId] = append(dep[rd.umId], rd)
+					reDep[rd.dmId] = append(reDep[rd.dmId], rd)
+				}
+			}
+		}
+	}
+	remoteDep := make(map[msId][]*Dependence)
+	for _, deps := range s.remoteDep { // 调用其他应用的流量先在上游副本之间均分，下游副本之间的均分在解析对端时进行
+		for _, d := range deps {
+			if s.ms[d.umId].replica != 0 {
+				continue
+			}
+			nu := s.ms[d.umId].replicaCount()
+			for i := 0; i < nu; i++ {
+				rd := &Dependence{umId: replicaIdOf(d.umId, i), dmId: d.dmId, trans: d.trans / float32(nu), calls: d.calls, dmApp: d.dmApp}
+				remoteDep[rd.umId] = append(remoteDep[rd.umId], rd)
+			}
+		}
+	}
+	s.dep, s.reDep, s.remoteDep = dep, reDep, remoteDep
+	s.topologyOrder, s.levelOrder = nil, nil
+}
+
+// schedulable 返回需要通过递归映射放置的微服务，即不固定位置的微服务
+func (s *Service) schedulable() map[msId]*Microservice {
+	ret := make(map[msId]*Microservice, len(s.ms))
+	for mid, ms := range s.ms {
+		if !ms.fixed() {
+			ret[mid] = ms
+		}
+	}
+	return ret
+}
+
+// trafficOf 返回微服务 mid 与已放置对端之间需要计入通信成本、网络干扰和链路预留的流量：包括 mid 调用的下游微服务，
+// 调用 mid 的固定位置上游微服务（不固定位置的上游微服务与 mid 之间的流量在上游放置时计入），mid 调用的其他已放置应用的微服务，
+// 以及进入根微服务的入口流量，
+// next 为 true 时按预放置节点计算，否则按放置节点计算
+func (s *Service) trafficOf(mid msId, next bool) []traffic {
+	ret := make([]traffic, 0, len(s.dep[mid]))
+	for _, dep := range s.dep[mid] {
+		if nid := s.ms[dep.dmId].nodeOf(next); nid != NotPlaced {
+			ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: nid, trans: dep.trans})
+		}
+	}
+	for _, dep := range s.reDep[mid] {
+		if um := s.ms[dep.umId]; um.fixed() && um.nodeOf(next) != NotPlaced {
+			ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: um.nodeOf(next), trans: dep.trans})
+		}
+	}
+	ret = append(ret, s.remoteOf(mid)...)
+	return append(ret, s.ingressOf(mid)...)
+}
+
+// ingressOf 返回进入微服务 mid 的入口流量，入口流量在所进入微服务（默认为根微服务）的副本之间均分
+func (s *Service) ingressOf(mid msId) []traffic {
+	ms := s.ms[mid]
+	ret := make([]traffic, 0, len(s.ingress))
+	for _, in := range s.ingress {
+		root := in.root
+		if root == "" {
+			root = s.rootId
+		}
+		if ms.originId() != root {
+			continue
+		}
+		ret = append(ret, traffic{
+			umId:  msId("ingress@" + in.gateway),
+			dmId:  mid,
+			peer:  in.gateway,
+			trans: in.trans / float32(ms.replicaCount()),
+		})
+	}
+	return ret
+}
+
+// settle 标记微服务 mid 的放置节点已确定，返回它与位置已确定的对端之间需要预分配链路带宽的流量，
+// 这样每条调用关系只在两端位置都确定后按最终位置预分配一次
+func (s *Service) settle(mid msId) []traffic {
+	s.settleMu.Lock()
+	defer s.settleMu.Unlock()
+	if s.settled == nil {
+		s.settled = make(map[msId]bool)
+	}
+	ret := make([]traffic, 0, len(s.dep[mid]))
+	for _, dep := range s.dep[mid] {
+		if dm := s.ms[dep.dmId]; dm.fixed() || s.settled[dm.id] {
+			ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: dm.nextPlaceNode, trans: dep.trans})
+		}
+	}
+	for _, dep := range s.reDep[mid] {
+		if um := s.ms[dep.umId]; um.fixed() || s.settled[um.id] {
+			ret = append(ret, traffic{umId: dep.umId, dmId: dep.dmId, peer: um.nextPlaceNode, trans: dep.trans})
+		}
+	}
+	s.settled[mid] = true
+	ret = append(ret, s.remoteOf(mid)...)
+	return append(ret, s.ingressOf(mid)...)
+}
+
+// replicasOf 返回微服务 origin 的所有副本
+func (s *Service) replicasOf(origin msId) []*Microservice {
+	ret := make([]*Microservice, 0)
+	for _, ms := range s.ms {
+		if ms.originId() == origin {
+			ret = append(ret, ms)
+		}
+	}
+	return ret
+}
+
+// violates 判断微服务 mid 放置在节点 nid 上时是否违背约束 con，尚未放置的对端不构成违背
+func (s *Service) violates(c *Cluster, con *Constraint, mid msId, nid nodeId) bool {
+	var other msId
+	switch s.ms[mid].originId() {
+	case con.a:
+		other = con.b
+	case con.b:
+		other = con.a
+	default:
+		return false
+	}
+	domain := c.domainOf(nid, con.scope)
+	placed, shared := 0, 0
+	for _, peer := range s.replicasOf(other) {
+		if peer.id == mid || peer.nextPlaceNode == NotPlaced {
+			continue
+		}
+		placed++
+		if c.domainOf(peer.nextPlaceNode, con.scope) == domain {
+			shared++
+		}
+	}
+	if con.kind == AntiAffinity {
+		return shared > 0
+	}
+	return placed > 0 && shared == 0
+}
+
+// replicaPlacement 返回每个（微服务，副本）与工作节点的映射关系
+func (s *Service) replicaPlacement() map[replicaKey]nodeId {
+	ret := make(map[replicaKey]nodeId, len(s.ms))
+	for _, ms := range s.ms {
+		ret[replicaKey{ms: ms.originId(), replica: ms.replica}] = ms.placeNode
+	}
+	return ret
+}
+
 // setNextPlaceNode 预放置
 func (s *Service) setNextPlaceNode(mid msId, nid nodeId) {
 	s.ms[mid].nextPlaceNode = nid
@@ -121,6 +493,9 @@ func (s *Service) rollbackPlaceStat() {
 	for _, ms := range s.ms {
 		s.ms[ms.id].nextPlaceNode = ms.placeNode
 	}
+	s.settled = nil
+	s.tx = nil
+	s.remote = nil
 }
 
 // commitPlaceStat 确认微服务放置节点位置
@@ -134,33 +509,67 @@ func (s *Service) commitPlaceStat() {
 // Cluster Profile
 //
 type Cluster struct {
-	nodes map[nodeId]*Node            // node id -> node
-	links map[nodeId]map[nodeId]*Link // node id A, B -> link_{A, B}
-	hpg   *HyperGraph                 // hyper graph is used on the fm algorithm
+	nodes      map[nodeId]*Node            // node id -> node
+	links      map[nodeId]map[nodeId]*Link // node id A, B -> link_{A, B}
+	hpg        *HyperGraph                 // hyper graph is used on the fm algorithm
+	root       *Cluster                    // the whole cluster, nil if this is the whole cluster
+	congestion CongestionFunc              // link cost model, nil means static cost
+	saturation SaturationPolicy            // how to treat the paths that would oversubscribe a link
+	satPenalty float32                     // inter penalty of an oversubscribed link, see SetSaturation
+	coloCost   float32                     // cost of the communication between microservices on the same node
+	coloFree   bool                        // whether co-location is counted as zero interference
+	groups     map[string]*LinkGroup       // group id -> link group with an aggregate capacity
+	tx         *txn                        // reservations of the current scheduling attempt, nil means the committed state
+	branch     *branch                     // placements seen by a branch of parallel recursive mapping, nil if not forked
 }
 
 type Node struct {
-	id          nodeId
-	resType     []ResourceType
-	capa        map[ResourceType]*Resource // capacity
-	alloc       map[ResourceType]*Resource // allocated
-	nextAlloc   map[ResourceType]*Resource // assumptive allocated // FIXME 在确定一个服务的放置位置后（或调度失败）修改（或回溯）该值，而 alloc 在真正部署后再修改
-	args        map[ResourceType]float32   // arguments
-	maxGama     float32
-	minGama     float32
-	nextMaxGama float32
-	nextMinGama float32
-	threshold   float32 // this is T in paper
+	id        nodeId
+	resType   []ResourceType
+	capa      map[ResourceType]*Resource // capacity
+	alloc     map[ResourceType]*Resource // allocated, reservations of a scheduling attempt are kept in its txn until committed
+	args      map[ResourceType]float32   // arguments
+	maxGama   float32
+	minGama   float32
+	threshold float32 // this is T in paper
+	zone      string  // fault domain of the node, empty means the node itself is a fault domain
+	labels    map[string]string
+	taints    []Taint
+}
+
+// Taint 节点污点，微服务只有容忍节点的 NoSchedule 污点才能放置到该节点上
+type Taint struct {
+	key    string
+	value  string
+	effect TaintEffect
+}
+
+// Toleration 微服务对污点的容忍，value 为空时容忍该 key 的任意取值
+type Toleration struct {
+	key    string
+	value  string
+	effect TaintEffect
 }
 
+// TaintEffect 污点效果
+type TaintEffect uint
+
 type Link struct {
 	// endpoint from -> endpoint to
-	from          nodeId
-	to            nodeId
-	cost          float32
-	bandCap       float32
-	bandAlloc     float32
-	nextBandAlloc float32
+	from      nodeId
+	to        nodeId
+	cost      float32
+	bandCap   float32
+	bandAlloc float32
+	latency   float32      // one-way network latency
+	groups    []*LinkGroup // link groups which the link belongs to
+}
+
+// LinkGroup 链路组，组内所有链路共享一个聚合带宽容量，如机架（ToR）上行链路预算
+type LinkGroup struct {
+	id        string
+	bandCap   float32
+	bandAlloc float32
 }
 
 type Resource struct {
@@ -170,22 +579,391 @@ type Resource struct {
 
 type ResourceType uint
 
+// SaturationPolicy 链路饱和处理策略
+type SaturationPolicy uint
+
+// PathError 路径无效：目的节点不可达，或路径上相邻节点之间没有链路
+type PathError struct {
+	from nodeId
+	to   nodeId
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("invalid path: no link from %s to %s", e.from, e.to)
+}
+
+// SaturationError 链路（或链路组）剩余带宽不足以承载新增流量
+type SaturationError struct {
+	from  nodeId
+	to    nodeId
+	group string // not empty if the saturated one is a link group
+	trans float32
+	avail float32
+}
+
+func (e *SaturationError) Error() string {
+	if e.group != "" {
+		return fmt.Sprintf("link group %s saturated: trans=%.2f, available=%.2f", e.group, e.trans, e.avail)
+	}
+	return fmt.Sprintf("link %s -> %s saturated: trans=%.2f, available=%.2f", e.from, e.to, e.trans, e.avail)
+}
+
+// SLOError 应用的关键路径端到端时延超出其时延 SLO
+type SLOError struct {
+	app     appId
+	latency float32
+	slo     float32
+}
+
+func (e *SLOError) Error() string {
+	return fmt.Sprintf("app %s violates latency slo: critical path latency=%.2f, slo=%.2f", e.app, e.latency, e.slo)
+}
+
+// CongestionFunc 链路拥塞模型，根据链路预分配后的利用率 u给出成本放大系数，链路动态成本为 cost*f(u)
+type CongestionFunc func(u float32) float32
+
+// StaticCongestion 静态成本，不随链路利用率变化
+func StaticCongestion(u float32) float32 {
+	return 1
+}
+
+// MM1Congestion 使用 M/M/1 排队时延 1/(1-u) 作为放大系数，链路饱和时取 MaxCongestion
+func MM1Congestion(u float32) float32 {
+	if u >= 1 {
+		return MaxCongestion
+	}
+	if u < 0 {
+		u = 0
+	}
+	return float32(math.Min(float64(1/(1-u)), float64(MaxCongestion)))
+}
+
+// PiecewiseCongestion 分段线性拥塞定价：利用率不超过 knee 时不加价，超过后按 slope 线性增长
+func PiecewiseCongestion(knee, slope float32) CongestionFunc {
+	return func(u float32) float32 {
+		if u <= knee {
+			return 1
+		}
+		return float32(math.Min(float64(1+slope*(u-knee)), float64(MaxCongestion)))
+	}
+}
+
+// utilization 链路预分配后的利用率
+func (c *Cluster) utilization(link *Link) float32 {
+	return bandUtilization(c.nextBandOf(link), link.bandCap)
+}
+
+// available 链路组剩余可预分配带宽
+func (c *Cluster) available(g *LinkGroup) float32 {
+	return g.bandCap - c.tx.groupOf(g)
+}
+
+// nextAllocOf 节点预分配后的资源
+func (c *Cluster) nextAllocOf(node *Node, typ ResourceType) float32 {
+	return c.tx.allocOf(node, typ)
+}
+
+// nextGamaOf 节点预分配后的资源利用率最大值和最小值
+func (c *Cluster) nextGamaOf(node *Node) (float32, float32) {
+	return c.tx.gamaOf(node)
+}
+
+// nextBandOf 链路预分配后的带宽
+func (c *Cluster) nextBandOf(link *Link) float32 {
+	return c.tx.bandOf(link)
+}
+
+// bandUtilization 带宽利用率，容量无效时视为饱和
+func bandUtilization(alloc, capa float32) float32 {
+	if capa <= 0 {
+		return 1
+	}
+	return alloc / capa
+}
+
+// tolerates 判断微服务是否容忍污点
+func (ms *Microservice) tolerates(taint Taint) bool {
+	for _, t := range ms.tolerations {
+		if t.key == taint.key && (t.value == "" || t.value == taint.value) && t.effect == taint.effect {
+			return true
+		}
+	}
+	return false
+}
+
+// admits 判断节点标签是否满足微服务的节点选择器，且微服务容忍节点所有 NoSchedule 污点
+func (n *Node) admits(ms *Microservice) bool {
+	for key, value := range ms.nodeSelector {
+		if v, ok := n.labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	for _, taint := range n.taints {
+		if taint.effect == NoSchedule && !ms.tolerates(taint) {
+			return false
+		}
+	}
+	return true
+}
+
+// untolerated 返回微服务不容忍的 PreferNoSchedule 污点个数
+func (n *Node) untolerated(ms *Microservice) int {
+	cnt := 0
+	for _, taint := range n.taints {
+		if taint.effect == PreferNoSchedule && !ms.tolerates(taint) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
 func (c *Cluster) nodeCount() int {
 	return len(c.nodes)
 }
 
+// top 返回分区所属的整个集群
+func (c *Cluster) top() *Cluster {
+	if c.root != nil {
+		return c.root
+	}
+	return c
+}
+
+// subCluster 创建一个不含节点的分区，分区与整个集群共享链路和配置
+func (c *Cluster) subCluster() *Cluster {
+	return &Cluster{
+		nodes:  make(map[nodeId]*Node),
+		links:  c.links,
+		hpg:    nil,
+		root:   c.top(),
+		tx:     c.tx,
+		branch: c.branch,
+	}
+}
+
+// SetCongestion 设置链路拥塞模型，nil 表示使用静态成本
+func (c *Cluster) SetCongestion(f CongestionFunc) {
+	c.top().congestion = f
+}
+
+// congestionOf 链路利用率为 u 时的成本放大系数
+func (c *Cluster) congestionOf(u float32) float32 {
+	if f := c.top().congestion; f != nil {
+		return f(u)
+	}
+	return 1
+}
+
+// SetSaturation 设置链路饱和处理策略，penalty 为 SaturationPenalty 策略下每条超额订阅链路的干扰惩罚基数（<= 0 时取默认值）
+func (c *Cluster) SetSaturation(policy SaturationPolicy, penalty float32) {
+	c.top().saturation = policy
+	c.top().satPenalty = penalty
+}
+
+// linkInter 计算流量 trans 经过链路时受到的网络干扰（包括链路所属的链路组），链路会被超额订阅时按饱和策略惩罚或拒绝
+func (c *Cluster) linkInter(link *Link, trans float32) (float32, error) {
+	inter, ok := c.bandInter(link.bandCap, c.nextBandOf(link), trans)
+	if !ok {
+		return 0, &SaturationError{from: link.from, to: link.to, trans: trans, avail: link.bandCap - c.nextBandOf(link)}
+	}
+	for _, g := range link.groups {
+		gi, ok := c.bandInter(g.bandCap, c.tx.groupOf(g), trans)
+		if !ok {
+			return 0, &SaturationError{from: link.from, to: link.to, group: g.id, trans: trans, avail: c.available(g)}
+		}
+		inter += gi
+	}
+	return inter, nil
+}
+
+// bandInter 计算流量 trans 占用容量为 capa、已预分配 alloc 的带宽时受到的网络干扰，饱和策略为拒绝且会超额订阅时返回 false
+func (c *Cluster) bandInter(capa, alloc, trans float32) (float32, bool) {
+	avail := capa - alloc
+	if trans <= avail && avail > 0 {
+		// 越拥塞，放置后带来的干扰越大
+		return trans / avail * c.congestionOf(bandUtilization(alloc+trans, capa)), true
+	}
+	top := c.top()
+	if top.saturation == SaturationReject {
+		return 0, false
+	}
+	penalty := top.satPenalty
+	if penalty <= 0 {
+		penalty = DefaultSaturationPenalty
+	}
+	return penalty * bandUtilization(alloc+trans, capa), true // 超额订阅越严重，惩罚越大
+}
+
+// AddLinkGroup 添加链路组，pairs 中的每一对节点之间的链路（双向）共享聚合带宽容量 bandCap
+func (c *Cluster) AddLinkGroup(id string, bandCap float32, pairs [][2]nodeId) {
+	top := c.top()
+	if top.groups == nil {
+		top.groups = make(map[string]*LinkGroup)
+	}
+	g := &LinkGroup{id: id, bandCap: bandCap}
+	top.groups[id] = g
+	for _, pair := range pairs {
+		for _, link := range []*Link{c.links[pair[0]][pair[1]], c.links[pair[1]][pair[0]]} {
+			if link != nil && !link.inGroup(g) {
+				link.groups = append(link.groups, g)
+			}
+		}
+	}
+}
+
+// AddRackUplink 为机架添加上行链路预算，机架内节点与机架外节点之间的所有链路共享带宽容量 bandCap
+func (c *Cluster) AddRackUplink(id string, rack []nodeId, bandCap float32) {
+	inRack := make(map[nodeId]bool)
+	for _, nid := range rack {
+		inRack[nid] = true
+	}
+	pairs := make([][2]nodeId, 0)
+	for _, nid := range rack {
+		for to := range c.links[nid] {
+			if !inRack[to] {
+				pairs = append(pairs, [2]nodeId{nid, to})
+			}
+		}
+	}
+	c.AddLinkGroup(id, bandCap, pairs)
+}
+
+// linkGroups 返回节点 from、to 之间链路（双向）所属的链路组
+func (c *Cluster) linkGroups(from, to nodeId) []*LinkGroup {
+	ret := make([]*LinkGroup, 0)
+	for _, link := range []*Link{c.links[from][to], c.links[to][from]} {
+		if link == nil {
+			continue
+		}
+		for _, g := range link.groups {
+			dup := false
+			for _, r := range ret {
+				if r == g {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				ret = append(ret, g)
+			}
+		}
+	}
+	return ret
+}
+
+func (l *Link) inGroup(g *LinkGroup) bool {
+	for _, lg := range l.groups {
+		if lg == g {
+			return true
+		}
+	}
+	return false
+}
+
+// routeLatency 沿最小花费路径从 from 到 to 的网络时延，任一端未放置时为 0
+func (c *Cluster) routeLatency(from, to nodeId) float32 {
+	if from == NotPlaced || to == NotPlaced {
+		return 0
+	}
+	if from == to {
+		if link, ok := c.loopback(from); ok {
+			return link.latency
+		}
+		return 0
+	}
+	top := c.top()
+	_, paths := top.minimalCostPath(from, []nodeId{to})
+	path, ok := paths[to]
+	if !ok { // 不可达
+		return math.MaxFloat32 / 4
+	}
+	var lat float32 = 0
+	for i := 1; i < len(path); i++ {
+		lat += top.links[path[i-1]][path[i]].latency
+	}
+	return lat
+}
+
+// SetLoopback 设置节点回环链路（同节点通信）的带宽容量，未设置回环链路的节点视为回环带宽无限
+func (c *Cluster) SetLoopback(nid nodeId, bandCap float32) {
+	if link, ok := c.loopback(nid); ok {
+		link.bandCap = bandCap
+		return
+	}
+	if c.links[nid] == nil {
+		c.links[nid] = make(map[nodeId]*Link)
+	}
+	c.links[nid][nid] = &Link{
+		from:    nid,
+		to:      nid,
+		bandCap: bandCap,
+	}
+}
+
+// SetColocation 设置同节点通信的成本，zeroInter 为 true 时同节点通信不计网络干扰
+func (c *Cluster) SetColocation(cost float32, zeroInter bool) {
+	c.top().coloCost = cost
+	c.top().coloFree = zeroInter
+}
+
+// loopback 返回节点的回环链路
+func (c *Cluster) loopback(nid nodeId) (*Link, bool) {
+	link, ok := c.links[nid][nid]
+	return link, ok
+}
+
+// colocationCost 同节点通信成本，存在回环链路时随回环链路利用率变化
+func (c *Cluster) colocationCost(nid nodeId) float32 {
+	cost := c.top().coloCost
+	if link, ok := c.loopback(nid); ok {
+		cost *= c.congestionOf(c.utilization(link))
+	}
+	return cost
+}
+
+// colocationInter 同节点通信的网络干扰，没有回环链路时回环带宽无限，干扰为 0
+func (c *Cluster) colocationInter(nid nodeId, trans float32) (float32, error) {
+	if c.top().coloFree {
+		return 0, nil
+	}
+	link, ok := c.loopback(nid)
+	if !ok {
+		return 0, nil
+	}
+	return c.linkInter(link, trans)
+}
+
+// linkCost 根据链路当前利用率计算链路动态成本
+func (c *Cluster) linkCost(link *Link) float32 {
+	return link.cost * c.congestionOf(c.utilization(link))
+}
+
 // filterBalanceNode
 func (c *Cluster) filterBalanceNode(app *Service, mid msId) ([]nodeId, error) {
+	// condition 0: node selector and taints
+	n0 := make([]*Node, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		if !node.admits(app.ms[mid]) {
+			DLogINFO("cond0: (ms=%s, selector=%v), (node=%s, labels=%v, taints=%v)",
+				mid, app.ms[mid].nodeSelector, node.id, node.labels, node.taints)
+			continue
+		}
+		n0 = append(n0, node)
+	}
+	if len(n0) == 0 {
+		return nil, errors.New("no node matches the selector or tolerates the taints")
+	}
+
 	// condition 1: resource capacity
 	n1 := make([]nodeId, 0)
-	for _, node := range c.nodes {
+	for _, node := range n0 {
 		cond1 := true
 		for typ, req := range app.ms[mid].resReq {
 			capa := node.capa[typ].value
-			alloc := node.nextAlloc[typ].value
+			alloc := c.nextAllocOf(node, typ)
 			if req.value+alloc > capa {
 				DLogINFO("cond1: (ms=%s, type=%v, req=%.2f), (node=%s, alloc/cap=%.2f/%.2f)",
-					mid, typ, req.value, node.id, node.nextAlloc[typ].value, node.capa[typ].value)
+					mid, typ, req.value, node.id, alloc, capa)
 				cond1 = false
 				break
 			}
@@ -202,10 +980,10 @@ func (c *Cluster) filterBalanceNode(app *Service, mid msId) ([]nodeId, error) {
 	// condition 2: resource fragment
 	n2 := make([]nodeId, 0)
 	for _, nid := range n1 {
-		maxGama, minGama := c.nodes[nid].nextMaxGama, c.nodes[nid].nextMinGama
+		maxGama, minGama := c.nextGamaOf(c.nodes[nid])
 		for typ, req := range app.ms[mid].resReq {
 			capa := c.nodes[nid].capa[typ].value
-			alloc := c.nodes[nid].nextAlloc[typ].value
+			alloc := c.nextAllocOf(c.nodes[nid], typ)
 			gama := (alloc + req.value) / capa
 			if gama < minGama {
 				minGama = gama
@@ -228,18 +1006,36 @@ func (c *Cluster) filterBalanceNode(app *Service, mid msId) ([]nodeId, error) {
 	canPlaceN := make([]nodeId, 0)
 	for _, nid := range n2 {
 		cond3 := true
-		for _, dep := range app.dep[mid] {
-			dest := app.ms[dep.dmId].nextPlaceNode
-			if dest != NotPlaced {
-				link, ok := c.links[nid][dest]
-				if !ok || dep.trans+link.nextBandAlloc > link.bandCap {
-					if ok {
-						DLogINFO("cond3: (from=%s, to=%s, trans=%.2f), (from=%s, to=%s, band alloc/cap=%.2f/%.2f)",
-							dep.umId, dep.dmId, dep.trans, nid, dest, link.nextBandAlloc, link.bandCap)
-					}
+		groupNeed := make(map[*LinkGroup]float32) // 链路组需要新增的带宽
+		for _, t := range app.trafficOf(mid, true) {
+			dest := t.peer
+			if dest == nid { // 同节点通信只受回环链路带宽约束
+				if link, ok := c.loopback(nid); ok && t.trans+c.nextBandOf(link) > link.bandCap {
+					DLogINFO("cond3: (from=%s, to=%s, trans=%.2f), (loopback=%s, band alloc/cap=%.2f/%.2f)",
+						t.umId, t.dmId, t.trans, nid, c.nextBandOf(link), link.bandCap)
 					cond3 = false
 					break
 				}
+				continue
+			}
+			link, ok := c.links[nid][dest]
+			if !ok || t.trans+c.nextBandOf(link) > link.bandCap {
+				if ok {
+					DLogINFO("cond3: (from=%s, to=%s, trans=%.2f), (from=%s, to=%s, band alloc/cap=%.2f/%.2f)",
+						t.umId, t.dmId, t.trans, nid, dest, c.nextBandOf(link), link.bandCap)
+				}
+				cond3 = false
+				break
+			}
+			for _, g := range c.linkGroups(nid, dest) {
+				groupNeed[g] += t.trans
+			}
+		}
+		for g, need := range groupNeed { // 链路组聚合带宽约束，如机架上行链路预算
+			if cond3 && need > c.available(g) {
+				DLogINFO("cond3: (ms=%s, need=%.2f), (group=%s, band alloc/cap=%.2f/%.2f)",
+					mid, need, g.id, c.tx.groupOf(g), g.bandCap)
+				cond3 = false
 			}
 		}
 		if cond3 {
@@ -248,10 +1044,104 @@ func (c *Cluster) filterBalanceNode(app *Service, mid msId) ([]nodeId, error) {
 	}
 	DLogINFO("satisfy cond 3 for ms(id=%s): %v", mid, canPlaceN)
 
+	// condition 4: min spread of the replicas
+	canPlaceN = c.filterSpread(app, mid, canPlaceN)
+
+	// condition 5: hard affinity and anti-affinity constraints
+	if len(app.constraints) > 0 {
+		n5 := make([]nodeId, 0, len(canPlaceN))
+		for _, nid := range canPlaceN {
+			ok := true
+			for _, con := range app.constraints {
+				if con.hard && app.violates(c, con, mid, nid) {
+					DLogINFO("cond5: (ms=%s, constraint=%v %s-%s), (node=%s)", mid, con.kind, con.a, con.b, nid)
+					ok = false
+					break
+				}
+			}
+			if ok {
+				n5 = append(n5, nid)
+			}
+		}
+		canPlaceN = n5
+		DLogINFO("satisfy cond 5 for ms(id=%s): %v", mid, canPlaceN)
+	}
+
+	// condition 6: end-to-end latency SLO of the app
+	if app.sloLatency > 0 {
+		n6 := make([]nodeId, 0, len(canPlaceN))
+		for _, nid := range canPlaceN {
+			if lat := app.criticalPathLatency(c, app.placeWith(mid, nid)); lat > app.sloLatency {
+				DLogINFO("cond6: (app=%s, critical path latency=%.2f, slo=%.2f), (ms=%s), (node=%s)",
+					app.id, lat, app.sloLatency, mid, nid)
+				continue
+			}
+			n6 = append(n6, nid)
+		}
+		canPlaceN = n6
+		DLogINFO("satisfy cond 6 for ms(id=%s): %v", mid, canPlaceN)
+	}
+
 	return canPlaceN, nil
 }
 
-// minimalCostPath 使用 Dijkstra 算法（堆优化）计算 `src` 到达 `dest` 的最小花费和路径
+// filterSpread 过滤掉会导致副本无法满足最小打散数的节点：若放置到已被其他副本占用的拓扑域后，
+// 剩余未放置的副本即使各占一个新拓扑域也无法满足最小打散数，则只能选择新的拓扑域
+func (c *Cluster) filterSpread(app *Service, mid msId, nodes []nodeId) []nodeId {
+	ms := app.ms[mid]
+	if ms.minSpread <= 1 || ms.replicaCount() <= 1 {
+		return nodes
+	}
+	used := make(map[string]bool) // 其他副本已占用的拓扑域
+	unplaced := 0                 // 其他未放置的副本数
+	for _, r := range app.replicasOf(ms.originId()) {
+		if r.id == mid {
+			continue
+		}
+		if r.nextPlaceNode == NotPlaced {
+			unplaced++
+		} else {
+			used[c.domainOf(r.nextPlaceNode, ms.spreadBy)] = true
+		}
+	}
+	if len(used)+unplaced >= ms.minSpread {
+		return nodes
+	}
+	ret := make([]nodeId, 0, len(nodes))
+	for _, nid := range nodes {
+		if used[c.domainOf(nid, ms.spreadBy)] {
+			DLogINFO("cond4: (ms=%s, min spread=%d, used=%d, unplaced=%d), (node=%s)",
+				mid, ms.minSpread, len(used), unplaced, nid)
+			continue
+		}
+		ret = append(ret, nid)
+	}
+	DLogINFO("satisfy cond 4 for ms(id=%s): %v", mid, ret)
+	return ret
+}
+
+// domainOf 节点在给定拓扑层级上所属的拓扑域
+func (c *Cluster) domainOf(nid nodeId, level SpreadLevel) string {
+	if level == SpreadZone {
+		if node, ok := c.top().nodes[nid]; ok && node.zone != "" {
+			return node.zone
+		}
+	}
+	return string(nid)
+}
+
+// spreadOf 微服务 origin 的所有副本在预放置后分布的拓扑域数
+func (c *Cluster) spreadOf(app *Service, origin msId, level SpreadLevel) int {
+	domains := make(map[string]bool)
+	for _, r := range app.replicasOf(origin) {
+		if r.nextPlaceNode != NotPlaced {
+			domains[c.domainOf(r.nextPlaceNode, level)] = true
+		}
+	}
+	return len(domains)
+}
+
+// minimalCostPath 使用 Dijkstra 算法（堆优化）计算 `src` 到达 `dest` 的最小花费和路径，链路花费为随利用率变化的动态成本
 func (c *Cluster) minimalCostPath(src nodeId, dests []nodeId) (float32, map[nodeId][]nodeId) {
 	var maxCost float32 = math.MaxFloat32 / 2 // 假设该值足够大
 	visit := make(map[nodeId]bool)
@@ -261,6 +1151,16 @@ func (c *Cluster) minimalCostPath(src nodeId, dests []nodeId) (float32, map[node
 		cost[nid] = maxCost
 		visit[nid] = false
 	}
+	for nid, links := range c.links { // 链路端点可能是集群外部端点
+		for to := range links {
+			for _, id := range []nodeId{nid, to} {
+				if _, ok := cost[id]; !ok && c.top().nodes[id] == nil {
+					cost[id] = maxCost
+					visit[id] = false
+				}
+			}
+		}
+	}
 	cost[src] = 0
 	path[src] = PrevNull
 
@@ -270,8 +1170,9 @@ func (c *Cluster) minimalCostPath(src nodeId, dests []nodeId) (float32, map[node
 		mid := q.pop()
 		visit[mid] = true
 		for next, link := range c.links[mid] {
-			if !visit[next] && cost[next] > cost[mid]+link.cost {
-				cost[next] = cost[mid] + link.cost
+			lc := c.linkCost(link)
+			if !visit[next] && cost[next] > cost[mid]+lc {
+				cost[next] = cost[mid] + lc
 				path[next] = mid
 				q.push(next, cost[next])
 			}
@@ -280,6 +1181,10 @@ func (c *Cluster) minimalCostPath(src nodeId, dests []nodeId) (float32, map[node
 
 	var retCost float32 = 0
 	for _, nid := range dests {
+		if nid == src { // 同节点通信
+			retCost += c.colocationCost(src)
+			continue
+		}
 		if ct, ok := cost[nid]; ok && ct != maxCost {
 			retCost += ct
 		}
@@ -335,68 +1240,43 @@ func (c *Cluster) getMinCutSizeRecords() []*Record {
 	return c.hpg.minCutSizeRecords()
 }
 
-// incAllNextAlloc 预分配所有资源
+// incAllNextAlloc 在事务中预分配所有资源
 func (c *Cluster) incAllNextAlloc(nid nodeId, req map[ResourceType]Resource) {
 	for typ, res := range req {
 		c.incNextAlloc(nid, typ, res.value)
 	}
 }
 
-// incNextAlloc 预分配资源
+// incNextAlloc 在事务中预分配资源
 func (c *Cluster) incNextAlloc(nid nodeId, typ ResourceType, inc float32) {
-	c.nodes[nid].nextAlloc[typ].value += inc
+	c.tx.addAlloc(c.top().nodes[nid], typ, inc)
 }
 
-// decAllNextAlloc 回收所有预分配资源
+// decAllNextAlloc 在事务中回收所有资源
 func (c *Cluster) decAllNextAlloc(nid nodeId, req map[ResourceType]Resource) {
 	for typ, res := range req {
 		c.decNextAlloc(nid, typ, res.value)
 	}
 }
 
-// decNextAlloc 回收预分配资源
+// decNextAlloc 在事务中回收资源
 func (c *Cluster) decNextAlloc(nid nodeId, typ ResourceType, inc float32) {
-	c.nodes[nid].nextAlloc[typ].value -= inc
+	c.tx.addAlloc(c.top().nodes[nid], typ, -inc)
 }
 
-// rollbackPartitionNextAlloc 回滚一个分区预分配资源
-func (c *Cluster) rollbackPartitionNextAlloc(nodes map[nodeId]*Node) {
-	for _, node := range nodes {
-		for _, typ := range node.resType {
-			node.nextAlloc[typ].value = node.alloc[typ].value
-		}
-	}
-}
-
-// rollbackAlloc 将预分配资源回滚到原来的状态
-func (c *Cluster) rollbackAlloc() {
-	for _, node := range c.nodes {
-		for _, typ := range node.resType {
-			node.nextAlloc[typ].value = node.alloc[typ].value
-		}
-	}
-}
-
-// commitAlloc 确认预分配资源提交
-func (c *Cluster) commitAlloc() {
-	for _, node := range c.nodes {
-		for _, typ := range node.resType {
-			node.alloc[typ].value = node.nextAlloc[typ].value
-		}
-	}
+// updateNextGama 更新事务中节点的资源利用率情况 gama
+func (c *Cluster) updateNextGama(nid nodeId) {
+	node := c.top().nodes[nid]
+	maxGama, minGama := node.gamaWith(func(typ ResourceType) float32 { return c.nextAllocOf(node, typ) })
+	c.tx.setGama(node, maxGama, minGama)
 }
 
-// updateNextGama 更新资源利用率情况 gama
-func (c *Cluster) updateNextGama(nid nodeId) {
+// gamaWith 根据已分配资源 alloc 计算节点资源利用率的最大值和最小值
+func (n *Node) gamaWith(alloc func(typ ResourceType) float32) (float32, float32) {
 	var minGama float32 = math.MaxFloat32 / 2
 	var maxGama float32 = 0
-	node := c.nodes[nid]
-
-	for _, typ := range node.resType {
-		alloc := node.nextAlloc[typ].value
-		capa := node.capa[typ].value
-		gama := alloc / capa
-		//fmt.Println(alloc, capa)
+	for _, typ := range n.resType {
+		gama := alloc(typ) / n.capa[typ].value
 		if gama > maxGama {
 			maxGama = gama
 		}
@@ -404,73 +1284,48 @@ func (c *Cluster) updateNextGama(nid nodeId) {
 			minGama = gama
 		}
 	}
-	node.nextMinGama = minGama
-	node.nextMaxGama = maxGama
-}
-
-// rollbackGama 回滚资源利用率情况
-func (c *Cluster) rollbackGama() {
-	for _, node := range c.nodes {
-		node.nextMaxGama = node.maxGama
-		node.nextMinGama = node.minGama
-	}
+	return maxGama, minGama
 }
 
-// commitGama 确认资源利用率
-func (c *Cluster) commitGama() {
-	for _, node := range c.nodes {
-		node.maxGama = node.nextMaxGama
-		node.minGama = node.nextMinGama
-	}
-}
-
-// incNextBandAlloc 预分配链路带宽
+// incNextBandAlloc 在事务中预分配链路带宽，from == to 时预分配回环链路带宽（没有回环链路时不做记录）
 func (c *Cluster) incNextBandAlloc(from, to nodeId, inc float32) {
 	// 假设无向
 	if link, ok := c.links[from][to]; ok {
-		link.nextBandAlloc += inc
+		c.tx.addBand(link, inc)
 	}
 	if from != to {
 		if link, ok := c.links[to][from]; ok {
-			link.nextBandAlloc += inc
+			c.tx.addBand(link, inc)
 		}
-	}
-}
-
-// decNextBandAlloc 回收预分配链路带宽
-func (c *Cluster) decNextBandAlloc(from, to nodeId, inc float32) {
-	// 假设无向
-	if link, ok := c.links[from][to]; ok {
-		link.nextBandAlloc -= inc
-	}
-	if from != to {
-		if link, ok := c.links[to][from]; ok {
-			link.nextBandAlloc -= inc
+		for _, g := range c.linkGroups(from, to) { // 同一条流量在链路组中只计一次
+			c.tx.addGroup(g, inc)
 		}
 	}
 }
 
-func (c *Cluster) rollbackBandAlloc() {
-	for _, toList := range c.links {
-		for _, link := range toList {
-			link.nextBandAlloc = link.bandAlloc
+// reserveFixed 在事务中为两端位置都已固定的流量预分配链路带宽，它不经过路径选择，
+// 拒绝超额订阅链路时预分配前检查链路和链路组的剩余带宽，不足时返回 *SaturationError
+func (c *Cluster) reserveFixed(from, to nodeId, trans float32) error {
+	if from == to {
+		if _, err := c.colocationInter(from, trans); err != nil {
+			return err
 		}
 	}
-}
-
-func (c *Cluster) commitBandAlloc() {
-	for _, toList := range c.links {
-		for _, link := range toList {
-			link.bandAlloc = link.nextBandAlloc
+	for _, link := range []*Link{c.links[from][to], c.links[to][from]} {
+		if link == nil || from == to {
+			continue
+		}
+		if _, err := c.linkInter(link, trans); err != nil {
+			return err
 		}
 	}
+	c.incNextBandAlloc(from, to, trans)
+	return nil
 }
 
-// rollbackStat 回滚集群状态
-func (c *Cluster) rollbackStat() {
-	c.rollbackAlloc()
-	c.rollbackGama()
-	c.rollbackBandAlloc()
+// decNextBandAlloc 在事务中回收链路带宽
+func (c *Cluster) decNextBandAlloc(from, to nodeId, inc float32) {
+	c.incNextBandAlloc(from, to, -inc)
 }
 
 // clone 克隆集群状态，可用于撤销
@@ -486,11 +1341,9 @@ func (c *Cluster) clone() *Cluster {
 	for nid, node := range c.nodes {
 		ret.nodes[nid].alloc = map[ResourceType]*Resource{}
 		ret.nodes[nid].capa = map[ResourceType]*Resource{}
-		ret.nodes[nid].nextAlloc = map[ResourceType]*Resource{}
 		ret.nodes[nid].args = map[ResourceType]float32{}
 		copier.CopyWithOption(&ret.nodes[nid].alloc, &node.alloc, copier.Option{DeepCopy: true})
 		copier.CopyWithOption(&ret.nodes[nid].capa, &node.capa, copier.Option{DeepCopy: true})
-		copier.CopyWithOption(&ret.nodes[nid].nextAlloc, &node.nextAlloc, copier.Option{DeepCopy: true})
 		copier.CopyWithOption(&ret.nodes[nid].args, &node.args, copier.Option{DeepCopy: true})
 	}
 	//for from, links := range c.links {
@@ -42,25 +42,31 @@ func TestClusterProfile(t *testing.T) {
 	}
 	fmt.Println("total min cost: ", minCost)
 
-	tCluster.incNextAlloc("node0", ResCPU, 4)
-	tCluster.updateNextGama("node0")
-	tCluster.incNextAlloc("node0", ResMem, 100*MB)
-	tCluster.updateNextGama("node0")
-	tCluster.incNextBandAlloc("node0", "node1", KB)
-	fmt.Println("next alloc cpu: ", tCluster.nodes["node0"].nextAlloc[ResCPU].value)
-	fmt.Println("next band alloc from 0 to 1: ", tCluster.links["node0"]["node1"].nextBandAlloc)
-	fmt.Println("next band alloc from 1 to 0: ", tCluster.links["node1"]["node0"].nextBandAlloc)
-	fmt.Println("next max gama: ", tCluster.nodes["node0"].nextMaxGama)
-	fmt.Println("next min gama: ", tCluster.nodes["node0"].nextMinGama)
-	tCluster.commitAlloc()
+	view := tCluster.begin()
+	view.incNextAlloc("node0", ResCPU, 4)
+	view.updateNextGama("node0")
+	view.incNextAlloc("node0", ResMem, 100*MB)
+	view.updateNextGama("node0")
+	view.incNextBandAlloc("node0", "node1", KB)
+	maxGama, minGama := view.nextGamaOf(view.nodes["node0"])
+	fmt.Println("next alloc cpu: ", view.nextAllocOf(view.nodes["node0"], ResCPU))
+	fmt.Println("next band alloc from 0 to 1: ", view.nextBandOf(view.links["node0"]["node1"]))
+	fmt.Println("next band alloc from 1 to 0: ", view.nextBandOf(view.links["node1"]["node0"]))
+	fmt.Println("next max gama: ", maxGama)
+	fmt.Println("next min gama: ", minGama)
+	if tCluster.nodes["node0"].alloc[ResCPU].value != 0 {
+		t.Fatalf("expect reservations to stay in the txn before commit")
+	}
+	view.commit()
 	fmt.Println("alloc cpu: ", tCluster.nodes["node0"].alloc[ResCPU].value)
-	tCluster.commitBandAlloc()
 	fmt.Println("band alloc from 0 to 1: ", tCluster.links["node0"]["node1"].bandAlloc)
 	fmt.Println("band alloc from 1 to 0: ", tCluster.links["node1"]["node0"].bandAlloc)
-	tCluster.commitGama()
 	fmt.Println("max gama: ", tCluster.nodes["node0"].maxGama)
 	fmt.Println("min gama: ", tCluster.nodes["node0"].minGama)
 	fmt.Println()
+	if tCluster.nodes["node0"].alloc[ResCPU].value != 4 || tCluster.links["node1"]["node0"].bandAlloc != KB || tCluster.nodes["node0"].maxGama != maxGama {
+		t.Fatalf("expect the txn to be committed")
+	}
 
 	fmt.Println("hyper edges:")
 	records := tCluster.hyperGraphPartition()
@@ -80,6 +86,211 @@ func TestClusterProfile(t *testing.T) {
 	}
 }
 
+func TestCongestionCost(t *testing.T) {
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand).begin()
+	tCluster.SetCongestion(MM1Congestion)
+
+	cost, path := tCluster.minimalCostPath("node0", []nodeId{"node1"})
+	fmt.Println("idle link, node0 -> node1:", path["node1"], "cost:", cost)
+	if len(path["node1"]) != 2 {
+		t.Fatalf("expect direct path on an idle link, got %v", path["node1"])
+	}
+
+	fmt.Println("saturate 95% of the link between node0 and node1")
+	tCluster.incNextBandAlloc("node0", "node1", 0.95*DefaultBrand)
+	cost, path = tCluster.minimalCostPath("node0", []nodeId{"node1"})
+	fmt.Println("hot link, node0 -> node1:", path["node1"], "cost:", cost)
+	if len(path["node1"]) != 3 {
+		t.Fatalf("expect path to detour around the hot link, got %v", path["node1"])
+	}
+
+	f := PiecewiseCongestion(0.5, 10)
+	fmt.Println("piecewise congestion: ", f(0.2), f(0.5), f(0.8), f(1))
+	if f(0.2) != 1 || f(0.8) <= 1 {
+		t.Fatalf("unexpected piecewise congestion factor")
+	}
+}
+
+func TestColocation(t *testing.T) {
+	tService := newTestService(DefaultResReq, DefaultBandReq)
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand).begin()
+	mts := newTestMOTAS(tCluster, tService)
+	tService.ms["B"].placeNode = "node0"
+	tService.ms["B"].nextPlaceNode = "node0"
+
+	fmt.Println("remove the loopback of node0, intra-node bandwidth is unlimited")
+	delete(tCluster.links["node0"], "node0")
+	tCluster.incNextBandAlloc("node0", "node0", DefaultBrand)
+	nodes, _ := tCluster.filterBalanceNode(tService, "A")
+	if !containsNode(nodes, "node0") {
+		t.Fatalf("expect node0 to be a candidate without loopback, got %v", nodes)
+	}
+
+	tCluster.SetColocation(3, false)
+	cost, _ := tCluster.minimalCostPath("node0", []nodeId{"node0"})
+	fmt.Println("co-location cost:", cost)
+	if cost != 3 {
+		t.Fatalf("expect co-location cost 3, got %v", cost)
+	}
+
+	fmt.Println("set a 20M loopback for node0, and reserve 10M on it")
+	tCluster.SetLoopback("node0", 20*MB)
+	tCluster.incNextBandAlloc("node0", "node0", 10*MB)
+	nodes, _ = tCluster.filterBalanceNode(tService, "A")
+	if containsNode(nodes, "node0") {
+		t.Fatalf("expect node0 to be filtered by its loopback bandwidth, got %v", nodes)
+	}
+	inter, err := mts.getInter(tCluster, tService.id, "A", "node0", nil)
+	fmt.Println("co-location inter:", inter, err)
+	if inter == 0 {
+		t.Fatalf("expect co-location inter on the loopback")
+	}
+
+	tCluster.SetColocation(3, true)
+	inter, _ = mts.getInter(tCluster, tService.id, "A", "node0", nil)
+	fmt.Println("co-location inter (zero inter):", inter)
+	if inter != 0 {
+		t.Fatalf("expect zero co-location inter, got %v", inter)
+	}
+}
+
+func TestRackUplink(t *testing.T) {
+	tService := newTestService(DefaultResReq, DefaultBandReq)
+	base := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
+	tCluster := base.begin()
+	mts := newTestMOTAS(tCluster, tService)
+	tService.ms["B"].placeNode = "node2"
+	tService.ms["B"].nextPlaceNode = "node2"
+
+	fmt.Println("rack {node0, node1} has a 20M uplink, 10M of which is reserved")
+	tCluster.AddRackUplink("rack0", []nodeId{"node0", "node1"}, 20*MB)
+	tCluster.incNextBandAlloc("node1", "node3", 10*MB)
+	rack0 := tCluster.groups["rack0"]
+	fmt.Printf("rack0 uplink alloc/cap=%.2f/%.2f\n", tCluster.tx.groupOf(rack0), rack0.bandCap)
+	if tCluster.tx.groupOf(rack0) != 10*MB {
+		t.Fatalf("expect traffic to be counted once in the rack uplink")
+	}
+
+	nodes, _ := tCluster.filterBalanceNode(tService, "A")
+	fmt.Println("candidates of A:", nodes)
+	if containsNode(nodes, "node0") || containsNode(nodes, "node1") || !containsNode(nodes, "node3") {
+		t.Fatalf("expect the rack nodes to be filtered by the uplink budget, got %v", nodes)
+	}
+
+	_, path := tCluster.minimalCostPath("node3", []nodeId{"node2"})
+	inter3, _ := mts.getInter(tCluster, tService.id, "A", "node3", path)
+	_, path = tCluster.minimalCostPath("node0", []nodeId{"node2"})
+	inter0, _ := mts.getInter(tCluster, tService.id, "A", "node0", path)
+	fmt.Println("inter on node3:", inter3, "inter on node0:", inter0)
+	if inter0 <= inter3 {
+		t.Fatalf("expect the rack uplink to be scored in inter")
+	}
+
+	if base.available(rack0) != rack0.bandCap { // 放弃事务
+		t.Fatalf("expect rack uplink reservations to stay in the txn")
+	}
+}
+
+func TestCriticalPathLatency(t *testing.T) {
+	tService := newTestService(DefaultResReq, DefaultBandReq)
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
+	for from, links := range tCluster.links {
+		for to, link := range links {
+			if from != to {
+				link.latency = 1
+			}
+		}
+	}
+	tService.dep["A"][0].calls = 2 // A calls B twice per request
+	placement := map[msId]nodeId{"A": "node0", "B": "node1", "C": "node0", "D": "node2", "E": "node1", "F": "node0"}
+	for mid, nid := range placement {
+		tService.setNextPlaceNode(mid, nid)
+	}
+
+	lat := tService.criticalPathLatency(tCluster, tService.nextPlacement)
+	fmt.Println("critical path latency:", lat)
+	if lat != 4 { // A -2x-> B -> D
+		t.Fatalf("expect critical path latency 4, got %v", lat)
+	}
+
+	tService.sloLatency = 3
+	nodes, _ := tCluster.filterBalanceNode(tService, "A")
+	fmt.Println("candidates of A with slo 3:", nodes)
+	if len(nodes) != 1 || nodes[0] != "node1" {
+		t.Fatalf("expect only node1 satisfies the slo, got %v", nodes)
+	}
+}
+
+func TestConstraintFilter(t *testing.T) {
+	tService := newTestService(DefaultResReq, DefaultBandReq)
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
+	mts := newTestMOTAS(tCluster, tService)
+	tCluster.nodes["node0"].zone, tCluster.nodes["node1"].zone = "zone0", "zone0"
+	tCluster.nodes["node2"].zone, tCluster.nodes["node3"].zone = "zone1", "zone1"
+	tService.setNextPlaceNode("B", "node3")
+	tService.setNextPlaceNode("C", "node2")
+	tService.constraints = []*Constraint{
+		{kind: AntiAffinity, scope: SpreadNode, a: "A", b: "B", hard: true},
+		{kind: Affinity, scope: SpreadZone, a: "C", b: "A", hard: true},
+		{kind: Affinity, scope: SpreadNode, a: "A", b: "C", weight: 10},
+	}
+
+	nodes, _ := tCluster.filterBalanceNode(tService, "A")
+	fmt.Println("candidates of A:", nodes)
+	if len(nodes) != 1 || nodes[0] != "node2" {
+		t.Fatalf("expect only node2 satisfies the hard constraints, got %v", nodes)
+	}
+
+	fmt.Println("penalty on node2:", mts.getPenalty(tCluster, tService.id, "A", "node2"))
+	fmt.Println("penalty on node3:", mts.getPenalty(tCluster, tService.id, "A", "node3"))
+	if mts.getPenalty(tCluster, tService.id, "A", "node2") != 0 || mts.getPenalty(tCluster, tService.id, "A", "node3") != 10 {
+		t.Fatalf("unexpected soft constraint penalty")
+	}
+}
+
+func TestNodeSelectorAndTaints(t *testing.T) {
+	tService := newTestService(DefaultResReq, DefaultBandReq)
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
+	mts := newTestMOTAS(tCluster, tService)
+	tCluster.nodes["node0"].labels = map[string]string{"disk": "ssd"}
+	tCluster.nodes["node1"].labels = map[string]string{"disk": "hdd"}
+	tCluster.nodes["node3"].taints = []Taint{{key: "dedicated", value: "gpu", effect: NoSchedule}}
+	tCluster.nodes["node2"].taints = []Taint{{key: "spot", effect: PreferNoSchedule}}
+
+	tService.ms["D"].nodeSelector = map[string]string{"disk": "ssd"}
+	nodes, _ := tCluster.filterBalanceNode(tService, "D")
+	fmt.Println("candidates of D (disk=ssd):", nodes)
+	if len(nodes) != 1 || nodes[0] != "node0" {
+		t.Fatalf("expect only node0 matches the selector, got %v", nodes)
+	}
+
+	nodes, _ = tCluster.filterBalanceNode(tService, "E")
+	fmt.Println("candidates of E:", nodes)
+	if containsNode(nodes, "node3") {
+		t.Fatalf("expect node3 to be filtered by its taint, got %v", nodes)
+	}
+	tService.ms["E"].tolerations = []Toleration{{key: "dedicated", effect: NoSchedule}}
+	nodes, _ = tCluster.filterBalanceNode(tService, "E")
+	fmt.Println("candidates of E (tolerates dedicated):", nodes)
+	if !containsNode(nodes, "node3") {
+		t.Fatalf("expect node3 to be a candidate with toleration, got %v", nodes)
+	}
+
+	fmt.Println("penalty of E on node2:", mts.getPenalty(tCluster, tService.id, "E", "node2"))
+	if mts.getPenalty(tCluster, tService.id, "E", "node2") != TaintPenalty {
+		t.Fatalf("expect a penalty for the PreferNoSchedule taint")
+	}
+}
+
+func containsNode(nodes []nodeId, nid nodeId) bool {
+	for _, n := range nodes {
+		if n == nid {
+			return true
+		}
+	}
+	return false
+}
+
 func TestFilterBalanceNode(t *testing.T) {
 	tService := newTestService(DefaultResReq, DefaultBandReq)
 	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
@@ -119,29 +330,24 @@ func TestClusterClone(t *testing.T) {
 			fmt.Printf("%v:%.2f ", typ, res.value)
 		}
 		fmt.Println()
-		fmt.Printf("next alloc: ")
-		for typ, res := range node.nextAlloc {
-			fmt.Printf("%v:%.2f ", typ, res.value)
-		}
-		fmt.Println()
 
 		fmt.Printf("args: ")
 		for typ, v := range node.args {
 			fmt.Printf("%v:%.2f ", typ, v)
 		}
 		fmt.Println()
-		fmt.Printf("max gama:%.2f, min gama:%.2f, next max gama:%.2f, next min gama:%.2f, threshold:%.2f\n", node.maxGama, node.minGama, node.nextMaxGama, node.nextMinGama, node.threshold)
+		fmt.Printf("max gama:%.2f, min gama:%.2f, threshold:%.2f\n", node.maxGama, node.minGama, node.threshold)
 	}
 
 	fmt.Println("clone links: ")
 	for from, links := range clone.links {
 		for to, link := range links {
-			fmt.Printf("%s->%s: next band alloc:%.2f\n", from, to, link.nextBandAlloc)
+			fmt.Printf("%s->%s: band alloc:%.2f\n", from, to, link.bandAlloc)
 		}
 	}
 
 	for _, node := range tCluster.nodes {
-		node.nextMaxGama = 100
+		node.maxGama = 100
 		for _, typ := range node.resType {
 			node.alloc[typ].value = 100
 			node.capa[typ].value = 50
@@ -149,12 +355,12 @@ func TestClusterClone(t *testing.T) {
 	}
 	for _, links := range tCluster.links {
 		for _, link := range links {
-			link.nextBandAlloc = 1000
+			link.bandAlloc = 1000
 		}
 	}
 	fmt.Printf("max gama: ")
 	for _, node := range tCluster.nodes {
-		fmt.Printf("%.2f ", node.nextMaxGama)
+		fmt.Printf("%.2f ", node.maxGama)
 	}
 	fmt.Println()
 	fmt.Printf("alloc: ")
@@ -175,7 +381,7 @@ func TestClusterClone(t *testing.T) {
 	fmt.Println()
 	for from, links := range tCluster.links {
 		for to, link := range links {
-			fmt.Printf("%s->%s: next band alloc:%.2f\n", from, to, link.nextBandAlloc)
+			fmt.Printf("%s->%s: band alloc:%.2f\n", from, to, link.bandAlloc)
 		}
 	}
 	fmt.Println()
@@ -183,7 +389,7 @@ func TestClusterClone(t *testing.T) {
 	tCluster = clone
 	fmt.Printf("max gama: ")
 	for _, node := range tCluster.nodes {
-		fmt.Printf("%.2f ", node.nextMaxGama)
+		fmt.Printf("%.2f ", node.maxGama)
 	}
 	fmt.Println()
 	fmt.Printf("alloc: ")
@@ -204,7 +410,7 @@ func TestClusterClone(t *testing.T) {
 	fmt.Println()
 	for from, links := range tCluster.links {
 		for to, link := range links {
-			fmt.Printf("%s->%s: next band alloc:%.2f\n", from, to, link.nextBandAlloc)
+			fmt.Printf("%s->%s: band alloc:%.2f\n", from, to, link.bandAlloc)
 		}
 	}
 	fmt.Println()
@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+)
+
+// QuotaPolicy 租户超出配额时的处理策略
+type QuotaPolicy uint
+
+// resUsage 节点资源与链路带宽用量，也用于表示租户配额
+type resUsage struct {
+	res  map[ResourceType]float32 // resource type -> amount, absent types are unlimited in a quota
+	band float32                  // total reserved link bandwidth, negative is unlimited in a quota
+}
+
+func newResUsage() *resUsage {
+	return &resUsage{res: make(map[ResourceType]float32)}
+}
+
+func (u *resUsage) add(o *resUsage, sign float32) {
+	for rt, v := range o.res {
+		u.res[rt] += sign * v
+	}
+	u.band += sign * o.band
+}
+
+// QuotaError 租户用量超出配额
+type QuotaError struct {
+	tenant string
+	res    string
+	used   float32
+	req    float32
+	limit  float32
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("tenant %s exceeds %s quota: used=%.2f, request=%.2f, limit=%.2f", e.tenant, e.res, e.used, e.req, e.limit)
+}
+
+// demand 应用申请的节点资源（外部微服务不占用集群资源），链路带宽需放置后才能确定
+func (s *Service) demand() *resUsage {
+	u := newResUsage()
+	for _, ms := range s.ms {
+		if ms.external {
+			continue
+		}
+		for rt, r := range ms.resReq {
+			u.res[rt] += r.value
+		}
+	}
+	return u
+}
+
+// usageOf 应用按（预）放置位置实际占用的节点资源和链路带宽，每条流量在两端之间的链路上预留一次
+func (s *Service) usageOf(c *Cluster, next bool) *resUsage {
+	u := s.demand()
+	reserved := func(from, to nodeId, trans float32) {
+		_, ok := c.links[from][to]
+		if _, rok := c.links[to][from]; ok || rok {
+			u.band += trans
+		}
+	}
+	for _, ms := range s.ms {
+		for _, t := range s.ingressOf(ms.id) {
+			reserved(ms.nodeOf(next), t.peer, t.trans)
+		}
+	}
+	for _, deps := range s.dep {
+		for _, dep := range deps {
+			reserved(s.ms[dep.umId].nodeOf(next), s.ms[dep.dmId].nodeOf(next), dep.trans)
+		}
+	}
+	return u
+}
+
+// SetQuota 设置租户配额：res 中未出现的资源类型不受限制，band 为租户预留链路带宽总量上限，与资源类型一致，未设置（nil）时不受限制
+func (m *MOTAS) SetQuota(tenant string, res map[ResourceType]float32, band *float32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q := newResUsage()
+	q.add(&resUsage{res: res, band: -1}, 1)
+	if band != nil && *band >= 0 {
+		q.band = *band
+	}
+	m.quotas[tenant] = q
+	m.admitHeld()
+}
+
+// SetQuotaPolicy 设置应用超出租户配额时拒绝还是暂缓调度
+func (m *MOTAS) SetQuotaPolicy(policy QuotaPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.quotaPolicy = policy
+}
+
+// TenantUsage 返回租户当前已放置应用占用的节点资源和链路带宽
+func (m *MOTAS) TenantUsage(tenant string) (map[ResourceType]float32, float32) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	res := make(map[ResourceType]float32)
+	u, ok := m.usage[tenant]
+	if !ok {
+		return res, 0
+	}
+	for rt, v := range u.res {
+		res[rt] = v
+	}
+	return res, u.band
+}
+
+// Held 返回因超出租户配额而暂缓调度的应用
+func (m *MOTAS) Held() []appId {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ret := make([]appId, 0, len(m.held))
+	for _, app := range m.held {
+		ret = append(ret, app.id)
+	}
+	return ret
+}
+
+// checkQuota 检查租户在当前用量（不计 except 中的应用）基础上增加 req 后是否超出配额
+func (m *MOTAS) checkQuota(tenant string, req *resUsage, except ...appId) error {
+	q, ok := m.quotas[tenant]
+	if !ok {
+		return nil
+	}
+	used := newResUsage()
+	if u, ok := m.usage[tenant]; ok {
+		used.add(u, 1)
+	}
+	for _, aid := range except {
+		if app, ok := m.app[aid]; ok && app.tenant == tenant && app.reserved != nil {
+			used.add(app.reserved, -1)
+		}
+	}
+	resTypes := make([]ResourceType, 0, len(q.res))
+	for rt := range q.res {
+		resTypes = append(resTypes, rt)
+	}
+	sort.Slice(resTypes, func(i, j int) bool { return resTypes[i] < resTypes[j] })
+	for _, rt := range resTypes {
+		if used.res[rt]+req.res[rt] > q.res[rt] {
+			return &QuotaError{tenant: tenant, res: fmt.Sprintf("resource %d", rt), used: used.res[rt], req: req.res[rt], limit: q.res[rt]}
+		}
+	}
+	if q.band >= 0 && used.band+req.band > q.band {
+		return &QuotaError{tenant: tenant, res: "bandwidth", used: used.band, req: req.band, limit: q.band}
+	}
+	return nil
+}
+
+// byTenant 按租户汇总应用的用量，批量应用按成员所属租户分别汇总
+func (s *Service) byTenant(usage func(*Service) *resUsage) map[string]*resUsage {
+	ret := make(map[string]*resUsage)
+	apps := s.members
+	if apps == nil {
+		apps = []*Service{s}
+	}
+	for _, app := range apps {
+		if _, ok := ret[app.tenant]; !ok {
+			ret[app.tenant] = newResUsage()
+		}
+		ret[app.tenant].add(usage(app), 1)
+	}
+	return ret
+}
+
+// checkTenants 按租户名顺序逐个检查各租户增加 reqs 中的用量后是否超出配额
+func (m *MOTAS) checkTenants(reqs map[string]*resUsage, except ...appId) error {
+	tenants := make([]string, 0, len(reqs))
+	for tenant := range reqs {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	for _, tenant := range tenants {
+		if err := m.checkQuota(tenant, reqs[tenant], except...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserve 应用放置后计入租户用量，调用者需持有 m.mu
+func (m *MOTAS) reserve(app *Service) {
+	app.reserved = app.usageOf(m.cluster, false)
+	if _, ok := m.usage[app.tenant]; !ok {
+		m.usage[app.tenant] = newResUsage()
+	}
+	m.usage[app.tenant].add(app.reserved, 1)
+}
+
+// unreserve 应用被驱逐或移除后从租户用量中扣除，并重新准入暂缓调度的应用，调用者需持有 m.mu
+func (m *MOTAS) unreserve(app *Service) {
+	if app.reserved == nil {
+		return
+	}
+	m.usage[app.tenant].add(app.reserved, -1)
+	app.reserved = nil
+	m.admitHeld()
+}
+
+// hold 暂缓调度超出租户配额的应用，usage 为超出配额的各租户用量（映射后包括链路带宽），准入前重新检查，调用者需持有 m.mu
+func (m *MOTAS) hold(app *Service, usage map[string]*resUsage, err error) {
+	app.heldUsage = usage
+	m.held = append(m.held, app)
+	DLogINFO("⏸ app(id=%s) is held: %v", app.id, err)
+}
+
+// reject 拒绝映射后才发现超出租户配额（链路带宽在放置后才能确定）的应用，记录拒绝原因，调用者需持有 m.mu
+func (m *MOTAS) reject(app *Service, err error) {
+	delete(m.app, app.id)
+	m.rejected[app.id] = err
+	DLogINFO("🚫 app(id=%s) is rejected: %v", app.id, err)
+}
+
+// Rejected 返回映射后因超出租户配额被拒绝的应用及其原因
+func (m *MOTAS) Rejected() map[appId]error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ret := make(map[appId]error, len(m.rejected))
+	for aid, err := range m.rejected {
+		ret[aid] = err
+	}
+	return ret
+}
+
+// admitHeld 将不再超出租户配额的暂缓应用放入调度队列，调用者需持有 m.mu
+func (m *MOTAS) admitHeld() {
+	waiting := m.held[:0]
+	for _, app := range m.held {
+		switch {
+		case app.removed:
+		case m.checkTenants(app.heldUsage) != nil:
+			waiting = append(waiting, app)
+		default:
+			app.heldUsage = nil
+			m.scheduleQ.push(app)
+			DLogINFO("app(id=%s) is admitted and enters the scheduling queue", app.id)
+		}
+	}
+	m.held = waiting
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTenantQuota(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	small := map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}
+	first := newTestService(small, BandReq)
+	first.id, first.tenant = "first", "team-a"
+	second := newTestService(small, BandReq)
+	second.id, second.tenant = "second", "team-a"
+	other := newTestService(small, BandReq)
+	other.id, other.tenant = "other", "team-b"
+	mts := newTestMOTAS(cluster)
+	mts.SetQuota("team-a", map[ResourceType]float32{ResCPU: 10}, nil)
+
+	huge := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 3}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	huge.id, huge.tenant = "huge", "team-a"
+	var qe *QuotaError
+	if err := mts.AddTask(huge); !errors.As(err, &qe) {
+		t.Fatalf("expect app huge to be rejected by the quota, got %v", err)
+	}
+	if _, ok := mts.app[huge.id]; ok {
+		t.Fatalf("expect a rejected app not to be registered")
+	}
+
+	mts.SetQuotaPolicy(QuotaHold)
+	for _, app := range []*Service{first, second, other} {
+		if err := mts.AddTask(app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for !mts.scheduleQ.empty() {
+		if !mts.scheduleOne() {
+			t.Fatalf("expect the queued apps to be scheduled")
+		}
+	}
+	res, band := mts.TenantUsage("team-a")
+	fmt.Println("team-a usage:", res, band, "held:", mts.Held())
+	if !first.placed || !other.placed || second.placed || len(mts.Held()) != 1 {
+		t.Fatalf("expect app second to be held by the quota of team-a")
+	}
+	if !approxEqual(res[ResCPU], 6) || !approxEqual(band, first.usageOf(cluster, false).band) {
+		t.Fatalf("unexpected usage of team-a: %v %.2f", res, band)
+	}
+
+	if err := mts.RemoveApp(first.id); err != nil {
+		t.Fatal(err)
+	}
+	if len(mts.Held()) != 0 || mts.scheduleQ.empty() {
+		t.Fatalf("expect app second to be admitted after app first is removed")
+	}
+	if !mts.scheduleOne() || !second.placed {
+		t.Fatalf("expect app second to be scheduled")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestTenantBandwidthQuota(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	app.tenant = "team-a"
+	mts := newTestMOTAS(cluster)
+	mts.SetQuota("team-a", nil, bandOf(0))
+	mts.SetQuotaPolicy(QuotaHold)
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	if !mts.scheduleOne() || app.placed || len(mts.Held()) != 1 {
+		t.Fatalf("expect the app to be held once its bandwidth is known")
+	}
+	checkCommitted(t, mts)
+
+	mts.SetQuota("team-a", map[ResourceType]float32{ResCPU: 100}, bandOf(0)) // 带宽配额不变，不应重新映射
+	if !mts.scheduleQ.empty() || len(mts.Held()) != 1 {
+		t.Fatalf("expect the app to stay held while its bandwidth is still over the quota")
+	}
+	mts.SetQuota("team-a", nil, bandOf(100*BandReq))
+	if mts.scheduleQ.empty() || len(mts.Held()) != 0 {
+		t.Fatalf("expect the app to be admitted once the bandwidth quota is raised")
+	}
+	if !mts.scheduleOne() || !app.placed {
+		t.Fatalf("expect the admitted app to be placed")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestTenantBandwidthQuotaReject(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	app.tenant = "team-a"
+	mts := newTestMOTAS(cluster)
+	mts.SetQuota("team-a", nil, bandOf(0))
+	if err := mts.AddTask(app); err != nil { // 节点资源不超出配额，准入时无法拒绝
+		t.Fatal(err)
+	}
+	if mts.scheduleOne() || app.placed || len(mts.Held()) != 0 {
+		t.Fatalf("expect the app to be rejected once its bandwidth is known")
+	}
+	fmt.Println("rejected:", mts.Rejected())
+	if _, ok := mts.Rejected()[app.id]; !ok || mts.app[app.id] != nil {
+		t.Fatalf("expect the rejection to be recorded")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestTenantQuotaUnsetBandwidth(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	app.tenant = "team-a"
+	mts := newTestMOTAS(cluster)
+	mts.SetQuota("team-a", map[ResourceType]float32{ResCPU: 100}, nil) // 只限制 CPU
+	if err := mts.AddTask(app); err != nil {
+		t.Fatal(err)
+	}
+	if !mts.scheduleOne() || !app.placed {
+		t.Fatalf("expect the bandwidth not to be limited by a cpu-only quota")
+	}
+	checkCommitted(t, mts)
+}
+
+// bandOf 返回链路带宽配额
+func bandOf(band float32) *float32 {
+	return &band
+}
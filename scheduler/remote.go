@@ -0,0 +1,91 @@
+package scheduler
+
+// remoteDeps 返回调用其他应用的调用关系，批量应用返回成员调用批量之外的应用的调用关系（上游微服务按批量应用重新命名）
+func (s *Service) remoteDeps() map[msId][]*Dependence {
+	if s.members == nil {
+		return s.remoteDep
+	}
+	inBatch := make(map[appId]bool, len(s.members))
+	for _, member := range s.members {
+		inBatch[member.id] = true
+	}
+	ret := make(map[msId][]*Dependence)
+	for _, member := range s.members {
+		for um, deps := range member.remoteDep {
+			for _, dep := range deps {
+				if inBatch[dep.dmApp] {
+					continue
+				}
+				bum := batchMsId(member.id, um)
+				ret[bum] = append(ret[bum], &Dependence{umId: bum, dmId: dep.dmId, trans: dep.trans, calls: dep.calls, dmApp: dep.dmApp})
+			}
+		}
+	}
+	return ret
+}
+
+// calls 应用是否调用应用 aid
+func (s *Service) calls(aid appId) bool {
+	for _, deps := range s.remoteDeps() {
+		for _, dep := range deps {
+			if dep.dmApp == aid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveRemote 按对端应用当前的放置位置解析应用调用其他应用的流量，流量在下游微服务的副本之间均分，
+// 对端应用尚未放置的调用不计入，调用者需持有 m.mu（读锁即可）
+func (m *MOTAS) resolveRemote(app *Service) {
+	app.remote = nil
+	for um, deps := range app.remoteDeps() {
+		for _, dep := range deps {
+			peer, ok := m.app[dep.dmApp]
+			if !ok || !peer.placed {
+				DLogINFO("app(id=%s) ignores the call %s -> %s/%s: the callee is not placed", app.id, um, dep.dmApp, dep.dmId)
+				continue
+			}
+			if app.remote == nil {
+				app.remote = make(map[msId][]crossCall)
+			}
+			dms := peer.replicasOf(dep.dmId)
+			for _, dm := range dms {
+				app.remote[um] = append(app.remote[um], crossCall{
+					dmApp: peer.id,
+					dmId:  dm.id,
+					to:    dm.placeNode,
+					trans: dep.trans / float32(len(dms)),
+				})
+			}
+		}
+	}
+}
+
+// remoteOf 返回微服务 mid 调用其他已放置应用的流量
+func (s *Service) remoteOf(mid msId) []traffic {
+	ret := make([]traffic, 0, len(s.remote[mid]))
+	for _, call := range s.remote[mid] {
+		ret = append(ret, traffic{umId: mid, dmId: batchMsId(call.dmApp, call.dmId), peer: call.to, trans: call.trans})
+	}
+	return ret
+}
+
+// remoteCallsOf 返回微服务 mid 放置在节点 from 上后调用其他应用的跨应用调用记录
+func (s *Service) remoteCallsOf(mid msId, from nodeId) []crossCall {
+	ret := make([]crossCall, 0, len(s.remote[mid]))
+	for _, call := range s.remote[mid] {
+		call.umId, call.from = mid, from
+		ret = append(ret, call)
+	}
+	return ret
+}
+
+// recordRemote 应用放置后记录其调用其他应用的跨应用调用，任一端应用被移除或驱逐时回收其链路带宽
+func (s *Service) recordRemote() {
+	for mid, ms := range s.ms {
+		s.crossCalls = append(s.crossCalls, s.remoteCallsOf(mid, ms.placeNode)...)
+	}
+	s.remote = nil
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newTestShared 构造共享的认证服务应用 auth（S，固定在 node3）和调用它的应用 web（A -> B，B 调用 auth 的 S）
+func newTestShared(resReq map[ResourceType]Resource, bandReq, callReq float32) (*Service, *Service) {
+	auth := &Service{
+		id:     "auth",
+		rootId: "S",
+		ms: map[msId]*Microservice{
+			"S": {id: "S", resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced, pinNode: "node3"},
+		},
+		dep:   map[msId][]*Dependence{},
+		reDep: map[msId][]*Dependence{},
+	}
+	dep := &Dependence{umId: "A", dmId: "B", trans: bandReq}
+	web := &Service{
+		id:     "web",
+		rootId: "A",
+		ms: map[msId]*Microservice{
+			"A": {id: "A", resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced},
+			"B": {id: "B", resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced},
+		},
+		dep:       map[msId][]*Dependence{"A": {dep}},
+		reDep:     map[msId][]*Dependence{"B": {dep}},
+		remoteDep: map[msId][]*Dependence{"B": {{umId: "B", dmId: "S", trans: callReq, dmApp: "auth"}}},
+	}
+	return auth, web
+}
+
+func TestRemoteDependence(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	auth, web := newTestShared(resReq, BandReq, 3*BandReq)
+	mts := newTestMOTAS(cluster, auth, web)
+	placeApp(t, mts, "auth")
+
+	mts.resolveRemote(web)
+	cost3, _, _ := mts.getMinCost(cluster, web.id, "B", []nodeId{"node3"})
+	cost0, _, _ := mts.getMinCost(cluster, web.id, "B", []nodeId{"node0"})
+	fmt.Println("cost of B on node0:", cost0, "on node3:", cost3)
+	if cost0 <= cost3 {
+		t.Fatalf("expect the call to the shared service to count toward the cost")
+	}
+	placeApp(t, mts, "web")
+	fmt.Println("A ->", web.ms["A"].placeNode, "B ->", web.ms["B"].placeNode, "cross calls:", web.crossCalls)
+	if web.ms["B"].placeNode != "node3" {
+		t.Fatalf("expect the caller of the shared service to be pulled to its node, got %s", web.ms["B"].placeNode)
+	}
+	if len(web.crossCalls) != 1 || web.crossCalls[0].to != "node3" {
+		t.Fatalf("expect the call to the shared service to be recorded, got %v", web.crossCalls)
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.RemoveApp("auth"); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.crossCalls) != 0 {
+		t.Fatalf("expect the call to be dropped with the shared service")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestRemoteCalleeRemoved(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	auth, web := newTestShared(resReq, BandReq, 3*BandReq)
+	mts := newTestMOTAS(cluster, auth, web)
+	placeApp(t, mts, "auth")
+	mts.version++ // 使调用方的调度尝试在过期的快照上完成
+
+	a := mts.tryApp(web)
+	if a.err != nil || len(web.remote["B"]) != 1 {
+		t.Fatalf("expect the call to be resolved, got err=%v", a.err)
+	}
+	if err := mts.RemoveApp("auth"); err != nil {
+		t.Fatal(err)
+	}
+	if !mts.finish(a) || mts.Conflicts() != 1 {
+		t.Fatalf("expect the attempt to conflict with the removal of the callee and be retried")
+	}
+	if !web.placed || len(web.crossCalls) != 0 {
+		t.Fatalf("expect the caller to be placed without the call to the removed app")
+	}
+	checkCommitted(t, mts)
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ReschedulePolicy 重调度策略：早期的放置结果是在当时的集群状态下做出的，随着应用的加入和离开可能不再是最优的，
+// 调度循环定期按 MOTAS 的效用值重新评估已放置的微服务，效用值下降超过迁移成本的迁移组成迁移计划
+type ReschedulePolicy struct {
+	threshold float32       // migration cost, a move is planned only if it lowers the score of the ms by more than it
+	maxMoves  int           // upper bound of the moves in one plan
+	apply     bool          // whether the plan is applied or only reported
+	interval  time.Duration // interval between two evaluations in the scheduling loop
+	last      time.Time     // last evaluation
+}
+
+func NewReschedulePolicy(threshold float32, maxMoves int, apply bool) *ReschedulePolicy {
+	return &ReschedulePolicy{
+		threshold: threshold,
+		maxMoves:  maxMoves,
+		apply:     apply,
+		interval:  RescheduleInterval,
+	}
+}
+
+// SetReschedule 设置重调度策略，调度循环按策略的间隔定期执行，policy 为 nil 时关闭
+func (m *MOTAS) SetReschedule(policy *ReschedulePolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reschedule = policy
+}
+
+// rescheduleDue 判断是否到了执行重调度的时间
+func (m *MOTAS) rescheduleDue() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.reschedule != nil && time.Since(m.reschedule.last) >= m.reschedule.interval
+}
+
+// Reschedule 按重调度策略生成迁移计划，策略要求执行时通过 applyPlan 执行，执行失败时返回计划和错误，集群保持原状
+func (m *MOTAS) Reschedule() (*MigrationPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	policy := m.reschedule
+	if policy == nil {
+		return nil, fmt.Errorf("no reschedule policy is set")
+	}
+	policy.last = time.Now()
+	plan := m.planReschedule(policy.threshold, policy.maxMoves)
+	if plan.Len() == 0 || !policy.apply {
+		return plan, nil
+	}
+	if err := m.applyPlan(plan); err != nil {
+		DLogINFO("reschedule plan fails: %v", err)
+		return plan, err
+	}
+	return plan, nil
+}
+
+// planReschedule 贪心地生成至多 maxMoves 次迁移：每一轮在已计划迁移后的事务视图中为每个未迁移的微服务选出效用值最小的新节点，
+// 选择效用值下降最多且超过 threshold 的一次迁移，每个微服务至多迁移一次，调用者需持有 m.mu
+func (m *MOTAS) planReschedule(threshold float32, maxMoves int) *MigrationPlan {
+	type candidate struct {
+		app *Service
+		ms  *Microservice
+	}
+	candidates := make([]candidate, 0)
+	for _, app := range m.app {
+		if !app.placed {
+			continue
+		}
+		for _, ms := range app.ms {
+			if !ms.fixed() {
+				candidates = append(candidates, candidate{app: app, ms: ms})
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].app.id != candidates[j].app.id {
+			return candidates[i].app.id < candidates[j].app.id
+		}
+		return candidates[i].ms.id < candidates[j].ms.id
+	})
+
+	c := m.cluster.begin()
+	plan := &MigrationPlan{moves: make([]*Migration, 0, maxMoves)}
+	moved := make(map[*Microservice]bool)
+	defer func() { // 计划不修改放置结果
+		for ms := range moved {
+			ms.nextPlaceNode = ms.placeNode
+		}
+	}()
+	for plan.Len() < maxMoves {
+		var (
+			best     *candidate
+			bestTo   nodeId
+			bestGain = threshold
+		)
+		for i, cand := range candidates {
+			if moved[cand.ms] {
+				continue
+			}
+			if to, gain := m.bestMove(c, cand.app, cand.ms.id); to != NotPlaced && gain > bestGain {
+				best, bestTo, bestGain = &candidates[i], to, gain
+			}
+		}
+		if best == nil {
+			break
+		}
+		from := best.ms.nextPlaceNode
+		m.detach(c, best.app, best.ms.id)
+		m.attach(c, best.app, best.ms.id, bestTo)
+		moved[best.ms] = true
+		plan.moves = append(plan.moves, &Migration{app: best.app.id, ms: best.ms.id, from: from, to: bestTo})
+		DLogINFO("reschedule plans to migrate ms %s/%s from node %s to node %s, score -%.2f",
+			best.app.id, best.ms.id, from, bestTo, bestGain)
+	}
+	return plan
+}
+
+// bestMove 在事务视图 c 中为已放置的微服务 mid 选出效用值最小的新节点，新节点需满足资源容量、资源均衡、链路带宽以及应用级约束，
+// 返回新节点及效用值的下降，没有更优的节点时返回 NotPlaced
+func (m *MOTAS) bestMove(c *Cluster, app *Service, mid msId) (nodeId, float32) {
+	var (
+		ms   = app.ms[mid]
+		from = ms.nextPlaceNode
+		v    = c.begin()
+	)
+	defer func() { ms.nextPlaceNode = from }()
+	m.detach(v, app, mid)
+	cur, err := m.placedScore(v, app, mid, from)
+	if err != nil { // 当前位置的路径无效或链路饱和
+		cur = math.MaxFloat32
+	}
+
+	nodes, _ := v.filterBalanceNode(app, mid)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	var (
+		to   = NotPlaced
+		gain float32
+	)
+	for _, nid := range nodes {
+		if nid == from {
+			continue
+		}
+		score, err := m.placedScore(v, app, mid, nid)
+		if err != nil || cur-score <= gain {
+			continue
+		}
+		w := v.begin()
+		m.attach(w, app, mid, nid)
+		ok := w.tx.validate() == nil && m.validatePlacement(w, app.id) == nil
+		ms.nextPlaceNode = from
+		if ok {
+			to, gain = nid, cur-score
+		}
+	}
+	return to, gain
+}
+
+// placedScore 计算已放置应用的微服务 mid 放置在节点 nid 上的效用值，与映射时不同，通信成本和网络干扰按它与全部对端之间的流量计算，
+// 事务视图 c 中不应包含该微服务占用的资源和链路带宽
+func (m *MOTAS) placedScore(c *Cluster, app *Service, mid msId, nid nodeId) (float32, error) {
+	ts := m.placedTraffic(app, mid)
+	dests := make([]nodeId, 0, len(ts))
+	for _, t := range ts {
+		dests = append(dests, t.peer)
+	}
+	cost, path := c.minimalCostPath(nid, dests)
+	inter, err := c.trafficInter(ts, nid, path)
+	if err != nil {
+		return math.MaxFloat32, err
+	}
+	frag := m.getFrag(c, app.id, mid, nid)
+	lat := m.getLatency(c, app.id, mid, nid)
+	penalty := m.getPenalty(c, app.id, mid, nid)
+	return m.score(cost, inter, frag, lat) + penalty, nil
+}
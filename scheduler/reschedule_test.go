@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+// placementCost 按放置节点之间链路的静态成本汇总应用内调用关系的通信成本
+func placementCost(cluster *Cluster, app *Service) float32 {
+	var cost float32
+	for _, deps := range app.dep {
+		for _, dep := range deps {
+			from, to := app.ms[dep.umId].placeNode, app.ms[dep.dmId].placeNode
+			if from != to {
+				cost += cluster.links[from][to].cost * dep.trans
+			}
+		}
+	}
+	return cost
+}
+
+// newTestDrift 将应用的微服务分散固定到各节点上放置，模拟早期的次优放置结果，放置后解除固定
+func newTestDrift(t *testing.T) (*Cluster, *Service, *MOTAS) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	pins := map[msId]nodeId{"A": "node0", "B": "node1", "C": "node2", "D": "node3", "E": "node0", "F": "node1"}
+	for mid, nid := range pins {
+		app.ms[mid].pinNode = nid
+	}
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+	for mid := range pins {
+		app.ms[mid].pinNode = ""
+	}
+	return cluster, app, mts
+}
+
+func TestReschedulePlan(t *testing.T) {
+	cluster, app, mts := newTestDrift(t)
+	before := placementCost(cluster, app)
+
+	mts.SetReschedule(NewReschedulePolicy(0, 2, false))
+	if !mts.rescheduleDue() {
+		t.Fatalf("expect the first evaluation to be due")
+	}
+	plan, err := mts.Reschedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Print("plan:\n", plan)
+	if plan.Len() == 0 || plan.Len() > 2 || mts.rescheduleDue() {
+		t.Fatalf("expect a plan of at most 2 moves, got %d", plan.Len())
+	}
+	for _, mv := range plan.moves {
+		if ms := app.ms[mv.ms]; ms.placeNode != mv.from || ms.nextPlaceNode != mv.from {
+			t.Fatalf("expect ms %s to stay on node %s before the plan is applied", mv.ms, mv.from)
+		}
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	after := placementCost(cluster, app)
+	fmt.Printf("cost: %.2f -> %.2f\n", before, after)
+	if after >= before {
+		t.Fatalf("expect the plan to lower the communication cost")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestRescheduleApply(t *testing.T) {
+	cluster, app, mts := newTestDrift(t)
+	before := placementCost(cluster, app)
+
+	mts.SetReschedule(NewReschedulePolicy(1e6, 10, true))
+	plan, err := mts.Reschedule()
+	if err != nil || plan.Len() != 0 {
+		t.Fatalf("expect no move to be worth a large migration cost, got %v, err=%v", plan, err)
+	}
+
+	mts.SetReschedule(NewReschedulePolicy(0, 10, true))
+	plan, err = mts.Reschedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := placementCost(cluster, app)
+	fmt.Printf("%d moves, cost: %.2f -> %.2f\n", plan.Len(), before, after)
+	for _, mv := range plan.moves {
+		if app.ms[mv.ms].placeNode != mv.to {
+			t.Fatalf("expect ms %s to be migrated to node %s", mv.ms, mv.to)
+		}
+	}
+	if plan.Len() == 0 || after >= before {
+		t.Fatalf("expect the applied plan to lower the communication cost")
+	}
+	checkCommitted(t, mts)
+
+	mts.SetReschedule(nil)
+	if _, err := mts.Reschedule(); err == nil || mts.rescheduleDue() {
+		t.Fatalf("expect rescheduling to be disabled")
+	}
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ResizeMicroservice 调整已放置微服务申请的资源，mid 需为副本所属微服务的 id，其全部副本按相同的资源调整，不接受副本 id。
+// 各副本依次处理：原节点在调整后仍满足资源容量和资源均衡条件时原地调整，否则按通信成本、网络干扰和资源碎片选出效用值最小的新节点，
+// 固定位置的副本只能原地调整。全部副本都能原地调整时直接执行并返回 nil，否则返回包含全部副本的迁移计划，由 ApplyPlan 执行
+func (m *MOTAS) ResizeMicroservice(aid appId, mid msId, req map[ResourceType]Resource) (*MigrationPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.app[aid]
+	if !ok || !app.placed {
+		return nil, fmt.Errorf("app %s is not placed", aid)
+	}
+	ms, ok := app.ms[mid]
+	if !ok {
+		return nil, fmt.Errorf("ms %s not found in app %s", mid, aid)
+	}
+	if ms.originId() != mid {
+		return nil, fmt.Errorf("ms %s is a replica of %s, resize %s to resize all its replicas", mid, ms.originId(), ms.originId())
+	}
+	if ms.external {
+		return nil, fmt.Errorf("ms %s is outside the cluster and consumes no node resource", mid)
+	}
+
+	replicas := app.replicasOf(mid)
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].replica < replicas[j].replica })
+	prev := make([]map[ResourceType]Resource, len(replicas))
+	for i, r := range replicas {
+		prev[i] = r.resReq
+	}
+	defer func() { // 计划不修改放置结果
+		for i, r := range replicas {
+			r.resReq, r.nextPlaceNode = prev[i], r.placeNode
+		}
+	}()
+
+	// 在事务视图中依次回收每个副本占用的资源和链路带宽，按调整后的资源重新过滤节点，后处理的副本能看到已处理副本的调整
+	var (
+		c       = m.cluster.begin()
+		plan    = &MigrationPlan{moves: make([]*Migration, 0, len(replicas))}
+		inPlace = true
+	)
+	for _, r := range replicas {
+		m.detach(c, app, r.id)
+		r.resReq = req
+		nodes, _ := c.filterBalanceNode(app, r.id)
+		from := r.placeNode
+		to := NotPlaced
+		for _, nid := range nodes {
+			if nid == from {
+				to = from
+				break
+			}
+		}
+		if to == NotPlaced && r.fixed() {
+			return nil, fmt.Errorf("ms %s/%s can not be resized: it is pinned to node %s which does not fit the new resources", aid, r.id, r.pinNode)
+		}
+		if to == NotPlaced {
+			var minScore float32 = math.MaxFloat32
+			for _, nid := range nodes {
+				score, _, err := m.evalPartition(c, aid, r.id, []nodeId{nid})
+				if err == nil && score < minScore {
+					minScore, to = score, nid
+				}
+			}
+		}
+		if to == NotPlaced {
+			return nil, fmt.Errorf("ms %s/%s can not be resized: no node fits the new resources", aid, r.id)
+		}
+		if to != from {
+			inPlace = false
+			DLogINFO("ms %s/%s does not fit node %s after resizing, plans to migrate it to node %s", aid, r.id, from, to)
+		}
+		m.attach(c, app, r.id, to)
+		plan.moves = append(plan.moves, &Migration{app: aid, ms: r.id, from: from, to: to, resReq: req})
+	}
+
+	if !inPlace {
+		return plan, nil
+	}
+	for i, r := range replicas { // applyPlan 从已放置状态开始执行
+		r.resReq, r.nextPlaceNode = prev[i], r.placeNode
+	}
+	if err := m.applyPlan(plan); err != nil {
+		return nil, err
+	}
+	for i := range prev { // 调整已生效
+		prev[i] = req
+	}
+	DLogINFO("ms %s/%s is resized in place with %d replicas", aid, mid, len(replicas))
+	return nil, nil
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestResizeInPlace(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	nid := app.ms["A"].placeNode
+	before := cluster.nodes[nid].alloc[ResCPU].value
+	small := map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 12 * MB}}
+	plan, err := mts.ResizeMicroservice(app.id, "A", small)
+	if err != nil || plan != nil {
+		t.Fatalf("expect A to be resized in place, got plan=%v, err=%v", plan, err)
+	}
+	fmt.Printf("cpu alloc of %s: %.2f -> %.2f\n", nid, before, cluster.nodes[nid].alloc[ResCPU].value)
+	if app.ms["A"].placeNode != nid || cluster.nodes[nid].alloc[ResCPU].value != before-1 {
+		t.Fatalf("expect the resources of A to shrink on node %s", nid)
+	}
+	checkCommitted(t, mts)
+}
+
+func TestResizeMigration(t *testing.T) {
+	cluster := newTestCluster(resType, 2*resCPU, 2*resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	app.ms["A"].pinNode, app.ms["B"].pinNode = "node0", "node0"
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+	app.ms["A"].pinNode, app.ms["B"].pinNode = "", ""
+
+	large := map[ResourceType]Resource{ResCPU: {ResCPU, 2*resCPU - 1}, ResMem: {ResMem, 2*resMem - 25*MB}}
+	plan, err := mts.ResizeMicroservice(app.id, "A", large)
+	if err != nil || plan == nil {
+		t.Fatalf("expect a migration plan, got err=%v", err)
+	}
+	fmt.Print("plan:\n", plan)
+	if plan.Len() != 1 || plan.moves[0].from != "node0" || plan.moves[0].to == "node0" {
+		t.Fatalf("expect A to be migrated off node0")
+	}
+	if app.ms["A"].resReq[ResCPU].value != resReq[ResCPU].value {
+		t.Fatalf("expect the resize not to take effect before the plan is applied")
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	if app.ms["A"].placeNode != plan.moves[0].to || app.ms["A"].resReq[ResCPU].value != 2*resCPU-1 {
+		t.Fatalf("expect A to be resized on node %s", plan.moves[0].to)
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ApplyPlan(plan); err == nil {
+		t.Fatalf("expect a stale plan to be rejected")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestMigrateCaller(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	auth, web := newTestShared(resReq, BandReq, BandReq)
+	mts := newTestMOTAS(cluster, auth, web)
+	placeApp(t, mts, "auth")
+	placeApp(t, mts, "web")
+
+	from := web.ms["B"].placeNode
+	to := nodeId("node0")
+	if from == to {
+		to = "node1"
+	}
+	plan := &MigrationPlan{moves: []*Migration{{app: "web", ms: "B", from: from, to: to}}}
+	if err := mts.ApplyPlan(plan); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("cross calls:", web.crossCalls)
+	if web.crossCalls[0].from != to {
+		t.Fatalf("expect the cross-app call to follow the caller")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestApplyPlanChecks(t *testing.T) {
+	cluster := newTestCluster(resType, 4*resCPU, 4*resMem, 8*brand)
+	app := newTestService(resReq, BandReq)
+	app.ms["B"].replicas, app.ms["B"].minSpread = 2, 2
+	app.expandReplicas()
+	app.ms["B"].pinNode, app.ms["B#1"].pinNode = "node0", "node1"
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+	app.ms["B"].pinNode, app.ms["B#1"].pinNode = "", ""
+
+	from, to := app.ms["B#1"].placeNode, app.ms["B"].placeNode
+	plan := &MigrationPlan{moves: []*Migration{{app: app.id, ms: "B#1", from: from, to: to}}}
+	err := mts.ApplyPlan(plan)
+	fmt.Println("move B#1 next to B:", err)
+	if err == nil || app.ms["B#1"].placeNode != from {
+		t.Fatalf("expect a plan breaking the replica spread to be rejected")
+	}
+	checkCommitted(t, mts)
+
+	a := app.ms["A"].placeNode
+	var target nodeId
+	for nid := range cluster.nodes {
+		if nid != a && (target == "" || nid < target) {
+			target = nid
+		}
+	}
+	cluster.nodes[target].threshold = -1 // 任何微服务都无法满足资源均衡阈值
+	plan = &MigrationPlan{moves: []*Migration{{app: app.id, ms: "A", from: a, to: target}}}
+	err = mts.ApplyPlan(plan)
+	fmt.Println("move A beyond the threshold:", err)
+	if err == nil || app.ms["A"].placeNode != a {
+		t.Fatalf("expect a plan breaking the node threshold to be rejected")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestResizeReplicas(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	app.ms["B"].replicas = 2
+	app.expandReplicas()
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	small := map[ResourceType]Resource{ResCPU: {ResCPU, 1}, ResMem: {ResMem, 12 * MB}}
+	if _, err := mts.ResizeMicroservice(app.id, "B#1", small); err == nil {
+		t.Fatalf("expect a replica id to be rejected")
+	}
+	plan, err := mts.ResizeMicroservice(app.id, "B", small)
+	if err != nil || plan != nil {
+		t.Fatalf("expect B to be resized in place, got plan=%v, err=%v", plan, err)
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ScaleMicroservice(app.id, "B", 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range app.replicasOf("B") {
+		fmt.Printf("%s -> %s: %v\n", r.id, r.placeNode, r.resReq)
+		if r.resReq[ResCPU].value != 1 {
+			t.Fatalf("expect replica %s to have the resized resources", r.id)
+		}
+	}
+	checkCommitted(t, mts)
+}
+
+func TestResizePinned(t *testing.T) {
+	cluster := newTestCluster(resType, 2*resCPU, 2*resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	app.ms["A"].pinNode, app.ms["B"].pinNode = "node0", "node0"
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	large := map[ResourceType]Resource{ResCPU: {ResCPU, 2*resCPU - 1}, ResMem: {ResMem, 2*resMem - 25*MB}}
+	plan, err := mts.ResizeMicroservice(app.id, "A", large)
+	fmt.Println("err:", err)
+	if err == nil || plan != nil || !strings.Contains(err.Error(), "pinned to node node0") {
+		t.Fatalf("expect the resize of a pinned ms to fail with a pinned error, got %v", err)
+	}
+	checkCommitted(t, mts)
+}
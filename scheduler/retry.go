@@ -0,0 +1,71 @@
+package scheduler
+
+import "time"
+
+// retryLater 处理调度失败的应用：失败次数未达上限时降低优先级并指数退避，达到上限后移入不可调度队列，调用者需持有 m.mu
+func (m *MOTAS) retryLater(app *Service, err error) {
+	app.attempts++
+	if app.attempts >= m.maxAttempts {
+		m.unschedulable[app.id] = app
+		DLogINFO("❌ app(id=%s) scheduling fails %d times (%v), moves to the unschedulable queue", app.id, app.attempts, err)
+		return
+	}
+	app.decPriority()
+	backoff := m.backoffBase << (app.attempts - 1)
+	if backoff > m.backoffMax || backoff <= 0 {
+		backoff = m.backoffMax
+	}
+	app.notBefore = time.Now().Add(backoff)
+	m.backoffQ = append(m.backoffQ, app)
+	DLogINFO("❌ app(id=%s) scheduling fails (%v), lowers the priority and retries after %v", app.id, err, backoff)
+}
+
+// flushBackoff 将退避结束的应用放回调度队列
+func (m *MOTAS) flushBackoff() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	waiting := m.backoffQ[:0]
+	for _, app := range m.backoffQ {
+		switch {
+		case app.removed:
+		case now.Before(app.notBefore):
+			waiting = append(waiting, app)
+		default:
+			m.scheduleQ.push(app)
+		}
+	}
+	m.backoffQ = waiting
+}
+
+// retryUnschedulable 集群容量变化（如添加节点、移除应用）后，将不可调度的应用重新放入调度队列，调用者需持有 m.mu
+func (m *MOTAS) retryUnschedulable() {
+	for aid, app := range m.unschedulable {
+		app.attempts = 0
+		app.notBefore = time.Time{}
+		m.scheduleQ.push(app)
+		delete(m.unschedulable, aid)
+		DLogINFO("app(id=%s) leaves the unschedulable queue and re-enters the scheduling queue", aid)
+	}
+}
+
+// Unschedulable 返回超过最大调度次数的应用
+func (m *MOTAS) Unschedulable() []appId {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ret := make([]appId, 0, len(m.unschedulable))
+	for aid := range m.unschedulable {
+		ret = append(ret, aid)
+	}
+	return ret
+}
+
+// SetRetryPolicy 设置调度失败的重试策略：最大调度次数、首次失败后的退避时间以及退避时间上限
+func (m *MOTAS) SetRetryPolicy(maxAttempts int, base, max time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxAttempts, m.backoffBase, m.backoffMax = maxAttempts, base, max
+}
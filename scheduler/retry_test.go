@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, brand)
+	huge := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 2 * resCPU}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	huge.id = "huge"
+	mts := newTestMOTAS(cluster)
+	mts.SetRetryPolicy(3, time.Hour, 3*time.Hour)
+	if err := mts.AddTask(huge); err != nil {
+		t.Fatal(err)
+	}
+
+	var notBefore []time.Time
+	for i := 0; i < 3; i++ {
+		if i > 0 { // 跳过退避直接重试
+			mts.backoffQ = mts.backoffQ[:0]
+			mts.scheduleQ.push(huge)
+		}
+		if mts.scheduleOne() {
+			t.Fatalf("expect app huge not to fit")
+		}
+		notBefore = append(notBefore, huge.notBefore)
+	}
+	fmt.Println("attempts:", huge.attempts, "unschedulable:", mts.Unschedulable())
+	if d0, d1 := time.Until(notBefore[0]), time.Until(notBefore[1]); d1 < d0+50*time.Minute {
+		t.Fatalf("expect exponential backoff, got %v then %v", d0, d1)
+	}
+	if len(mts.Unschedulable()) != 1 || huge.attempts != 3 {
+		t.Fatalf("expect app huge to be unschedulable after 3 attempts")
+	}
+
+	mts.flushBackoff()
+	if !mts.scheduleQ.empty() {
+		t.Fatalf("expect apps in backoff not to re-enter the queue")
+	}
+
+	big := &Node{
+		id:        "node4",
+		resType:   resType,
+		capa:      map[ResourceType]*Resource{ResCPU: {ResCPU, 20 * resCPU}, ResMem: {ResMem, resMem}},
+		alloc:     map[ResourceType]*Resource{ResCPU: {ResCPU, 0}, ResMem: {ResMem, 0}},
+		args:      map[ResourceType]float32{ResCPU: 0.5, ResMem: 0.5},
+		minGama:   math.MaxFloat32,
+		threshold: 0.8,
+	}
+	links := []*Link{{from: "node4", to: "node4", bandCap: 100 * brand}}
+	for nid := range cluster.nodes {
+		links = append(links, &Link{from: "node4", to: nid, bandCap: brand}, &Link{from: nid, to: "node4", bandCap: brand})
+	}
+	mts.AddNode(big, links)
+	if len(mts.Unschedulable()) != 0 || mts.scheduleQ.empty() || huge.attempts != 0 {
+		t.Fatalf("expect app huge to be retried after a node is added")
+	}
+}
+
+func TestRemoveAppRetries(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	first := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 3}, ResMem: {ResMem, 25 * MB}}, BandReq)
+	first.id = "first"
+	second := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 3}, ResMem: {ResMem, 25 * MB}}, BandReq)
+	second.id = "second"
+	mts := newTestMOTAS(cluster)
+	mts.SetRetryPolicy(1, time.Millisecond, time.Millisecond)
+	if err := mts.AddTask(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := mts.AddTask(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mts.scheduleOne() {
+		t.Fatalf("expect app first to be scheduled")
+	}
+	if mts.scheduleOne() {
+		t.Fatalf("expect app second not to fit")
+	}
+	if len(mts.Unschedulable()) != 1 {
+		t.Fatalf("expect app second to be unschedulable")
+	}
+
+	if err := mts.RemoveApp(first.id); err != nil {
+		t.Fatal(err)
+	}
+	checkCommitted(t, mts)
+	if !mts.scheduleOne() || !second.placed {
+		t.Fatalf("expect app second to be scheduled after app first is removed")
+	}
+	checkCommitted(t, mts)
+	if err := mts.RemoveApp(first.id); err == nil {
+		t.Fatalf("expect removing an unknown app to fail")
+	}
+}
+
+func TestFailedAppDoesNotBlock(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	huge := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, 2 * resCPU}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	huge.id, huge.priority = "huge", 1
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster)
+	mts.SetWorkers(1)
+	mts.SetRetryPolicy(3, time.Hour, time.Hour)
+	for _, a := range []*Service{huge, app} {
+		if err := mts.AddTask(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mts.tick()
+	fmt.Println("backoff:", len(mts.backoffQ), "placed:", app.placed)
+	if !app.placed || len(mts.backoffQ) != 1 || !mts.scheduleQ.empty() {
+		t.Fatalf("expect the app behind a failed app to be scheduled in the same round")
+	}
+	checkCommitted(t, mts)
+}
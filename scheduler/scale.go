@@ -0,0 +1,319 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+)
+
+// flow 两个节点之间预留了链路带宽的一条流量
+type flow struct {
+	from  nodeId
+	to    nodeId
+	trans float32
+}
+
+// flowsOf 返回应用按预放置节点预留了链路带宽的全部流量：应用内的调用、入口流量、调用其他应用以及其他应用调用本应用的流量
+func (m *MOTAS) flowsOf(app *Service) []flow {
+	ret := make([]flow, 0)
+	for _, deps := range app.dep {
+		for _, dep := range deps {
+			ret = append(ret, flow{from: app.ms[dep.umId].nextPlaceNode, to: app.ms[dep.dmId].nextPlaceNode, trans: dep.trans})
+		}
+	}
+	for _, ms := range app.ms {
+		for _, t := range app.ingressOf(ms.id) {
+			ret = append(ret, flow{from: ms.nextPlaceNode, to: t.peer, trans: t.trans})
+		}
+	}
+	for _, call := range app.crossCalls {
+		ret = append(ret, flow{from: app.ms[call.umId].nextPlaceNode, to: m.app[call.dmApp].ms[call.dmId].nextPlaceNode, trans: call.trans})
+	}
+	for _, caller := range m.app {
+		for _, call := range caller.crossCalls {
+			if call.dmApp == app.id && caller.id != app.id {
+				ret = append(ret, flow{from: caller.ms[call.umId].nextPlaceNode, to: app.ms[call.dmId].nextPlaceNode, trans: call.trans})
+			}
+		}
+	}
+	return ret
+}
+
+// ScaleMicroservice 将已放置应用中微服务 mid 的副本数调整为 n：扩容时每个新副本放置在与其上下游通信成本、网络干扰和资源碎片
+// 效用值最小的节点上；缩容时依次删除通信成本最大的副本（第 0 个副本沿用微服务 id，不会被删除）。
+// 微服务参与的调用关系的流量在调整后的副本之间重新均分，调整失败时应用保持原状
+func (m *MOTAS) ScaleMicroservice(aid appId, mid msId, n int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	app, ok := m.app[aid]
+	if !ok || !app.placed {
+		return fmt.Errorf("app %s is not placed", aid)
+	}
+	ms, ok := app.ms[mid]
+	if !ok {
+		return fmt.Errorf("ms %s not found in app %s", mid, aid)
+	}
+	origin := ms.originId()
+	if ms.fixed() {
+		return fmt.Errorf("ms %s is pinned and can not be scaled", origin)
+	}
+	if n < 1 {
+		return fmt.Errorf("ms %s needs at least 1 replica, got %d", origin, n)
+	}
+	cur := len(app.replicasOf(origin))
+	if n == cur {
+		return nil
+	}
+
+	// 保存应用描述，失败时恢复
+	var (
+		prevMs, prevDep, prevReDep, prevRemote = app.ms, app.dep, app.reDep, app.remoteDep
+		prevReplicas                           = app.ms[origin].replicas
+		prevCalls                              = make(map[appId][]crossCall, len(m.app))
+	)
+	for id, a := range m.app {
+		prevCalls[id] = a.crossCalls
+	}
+	restore := func() {
+		app.ms, app.dep, app.reDep, app.remoteDep = prevMs, prevDep, prevReDep, prevRemote
+		for _, r := range app.replicasOf(origin) {
+			r.replicas = prevReplicas
+		}
+		app.topologyOrder, app.levelOrder = nil, nil
+		for id, calls := range prevCalls {
+			m.app[id].crossCalls = calls
+		}
+		app.rollbackPlaceStat()
+	}
+
+	c := m.cluster.begin()
+	for _, f := range m.flowsOf(app) {
+		c.decNextBandAlloc(f.from, f.to, f.trans)
+	}
+	drop := make(map[msId]bool)
+	for i := n; i < cur; i++ { // 缩容：删除与上下游之间通信成本最大的副本，成本相同时删除序号最大的副本
+		var (
+			victim  *Microservice
+			maxCost float32 = -1
+		)
+		for _, r := range app.replicasOf(origin) {
+			if r.replica == 0 || drop[r.id] {
+				continue
+			}
+			dests := make([]nodeId, 0)
+			for _, t := range m.placedTraffic(app, r.id) {
+				dests = append(dests, t.peer)
+			}
+			cost, _ := c.minimalCostPath(r.placeNode, dests)
+			if cost > maxCost || (cost == maxCost && r.replica > victim.replica) {
+				victim, maxCost = r, cost
+			}
+		}
+		drop[victim.id] = true
+		c.decAllNextAlloc(victim.placeNode, victim.resReq)
+		c.updateNextGama(victim.placeNode)
+	}
+
+	added := app.resplit(origin, n, drop)
+	m.resplitCalls(app, origin, drop)
+	for _, r := range added { // 扩容：新副本放置在效用值最小的节点上
+		nodes, _ := c.filterBalanceNode(app, r.id)
+		var minScore float32 = math.MaxFloat32
+		for _, nid := range nodes {
+			score, _, err := m.evalPartition(c, aid, r.id, []nodeId{nid})
+			if err == nil && score < minScore {
+				minScore, r.nextPlaceNode = score, nid
+			}
+		}
+		if r.nextPlaceNode == NotPlaced {
+			restore()
+			return fmt.Errorf("out of resources: no node fits replica %s", r.id)
+		}
+		c.incAllNextAlloc(r.nextPlaceNode, r.resReq)
+		c.updateNextGama(r.nextPlaceNode)
+	}
+	for _, f := range m.flowsOf(app) {
+		c.incNextBandAlloc(f.from, f.to, f.trans)
+	}
+
+	err := m.validatePlacement(c, aid)
+	if err == nil {
+		err = c.tx.validate()
+	}
+	if err == nil {
+		err = m.checkTenants(m.usageDelta(map[appId]*Service{aid: app}))
+	}
+	if err != nil {
+		restore()
+		return err
+	}
+	c.commit()
+	m.version++
+	app.commitPlaceStat()
+	if app.reserved != nil {
+		m.usage[app.tenant].add(app.reserved, -1)
+	}
+	m.reserve(app)
+	m.refreshCrossCalls()
+	if n < cur { // 缩容腾出资源
+		m.admitHeld()
+		m.retryUnschedulable()
+	}
+	DLogINFO("ms %s/%s is scaled from %d to %d replicas", aid, origin, cur, n)
+	return nil
+}
+
+// resplit 将微服务 origin 的副本数调整为 n：删除 drop 中的副本，新增的副本按序号递增命名，
+// origin 参与的调用关系（包括调用其他应用的调用关系）的流量在调整后的副本之间重新均分，返回新增的副本。
+// 应用的微服务集合和调用关系替换为新建的 map，原 map 保持不变
+func (s *Service) resplit(origin msId, n int, drop map[msId]bool) []*Microservice {
+	type pair struct {
+		um msId
+		dm msId
+	}
+	type total struct {
+		trans float32
+		calls float32
+	}
+	// 按原始调用关系汇总 origin 参与的流量
+	pairs := make(map[pair]*total)
+	dep := make(map[msId][]*Dependence)
+	reDep := make(map[msId][]*Dependence)
+	for _, deps := range s.dep {
+		for _, d := range deps {
+			p := pair{um: s.ms[d.umId].originId(), dm: s.ms[d.dmId].originId()}
+			if p.um != origin && p.dm != origin {
+				dep[d.umId] = append(dep[d.umId], d)
+				reDep[d.dmId] = append(reDep[d.dmId], d)
+				continue
+			}
+			if pairs[p] == nil {
+				pairs[p] = &total{calls: d.calls}
+			}
+			pairs[p].trans += d.trans
+		}
+	}
+	remotes := make(map[pair]*total) // (origin, 对端应用的微服务) -> 流量，对端应用记录在 dmApp 中
+	dmApps := make(map[pair]appId)
+	remoteDep := make(map[msId][]*Dependence)
+	for um, deps := range s.remoteDep {
+		for _, d := range deps {
+			if s.ms[um].originId() != origin {
+				remoteDep[um] = append(remoteDep[um], d)
+				continue
+			}
+			p := pair{um: msId(d.dmApp), dm: d.dmId}
+			if remotes[p] == nil {
+				remotes[p] = &total{calls: d.calls}
+				dmApps[p] = d.dmApp
+			}
+			remotes[p].trans += d.trans
+		}
+	}
+
+	// 调整副本
+	kept := make(map[msId]*Microservice, len(s.ms))
+	next := 0
+	for mid, ms := range s.ms {
+		if drop[mid] {
+			continue
+		}
+		kept[mid] = ms
+		if ms.originId() == origin && ms.replica >= next {
+			next = ms.replica + 1
+		}
+	}
+	s.ms = kept
+	base := s.ms[origin]
+	added := make([]*Microservice, 0)
+	for len(s.replicasOf(origin)) < n {
+		rid := replicaIdOf(origin, next)
+		r := *base
+		r.id, r.origin, r.replica = rid, origin, next
+		r.placeNode, r.nextPlaceNode = NotPlaced, NotPlaced
+		s.ms[rid] = &r
+		added = append(added, &r)
+		next++
+	}
+	replicas := s.replicasOf(origin)
+	for _, r := range replicas {
+		r.replicas = n
+	}
+
+	// 在调整后的副本之间重新均分流量
+	for p, t := range pairs {
+		us, ds := s.replicasOf(p.um), s.replicasOf(p.dm)
+		for _, u := range us {
+			for _, d := range ds {
+				rd := &Dependence{umId: u.id, dmId: d.id, trans: t.trans / float32(len(us)*len(ds)), calls: t.calls}
+				dep[rd.umId] = append(dep[rd.umId], rd)
+				reDep[rd.dmId] = append(reDep[rd.dmId], rd)
+			}
+		}
+	}
+	for p, t := range remotes {
+		for _, u := range replicas {
+			rd := &Dependence{umId: u.id, dmId: p.dm, trans: t.trans / float32(len(replicas)), calls: t.calls, dmApp: dmApps[p]}
+			remoteDep[rd.umId] = append(remoteDep[rd.umId], rd)
+		}
+	}
+	s.dep, s.reDep, s.remoteDep = dep, reDep, remoteDep
+	s.topologyOrder, s.levelOrder = nil, nil
+	return added
+}
+
+// resplitCalls 微服务 origin 的副本调整后，将其与其他应用之间的跨应用调用在调整后的副本之间重新均分，
+// drop 为已删除的副本，调用者需持有 m.mu
+func (m *MOTAS) resplitCalls(app *Service, origin msId, drop map[msId]bool) {
+	isReplica := func(mid msId) bool {
+		if drop[mid] {
+			return true
+		}
+		ms, ok := app.ms[mid]
+		return ok && ms.originId() == origin
+	}
+	replicas := app.replicasOf(origin)
+	type key struct {
+		app appId
+		ms  msId
+	}
+
+	// 本应用的副本调用其他应用：按被调用的微服务汇总
+	out := make(map[key]float32)
+	calls := make([]crossCall, 0, len(app.crossCalls))
+	for _, call := range app.crossCalls {
+		if isReplica(call.umId) {
+			out[key{app: call.dmApp, ms: call.dmId}] += call.trans
+			continue
+		}
+		calls = append(calls, call)
+	}
+	for k, trans := range out {
+		for _, r := range replicas {
+			calls = append(calls, crossCall{umId: r.id, dmApp: k.app, dmId: k.ms, trans: trans / float32(len(replicas))})
+		}
+	}
+	app.crossCalls = calls
+
+	// 其他应用调用本应用的副本：按调用方微服务汇总
+	for _, caller := range m.app {
+		if caller.id == app.id {
+			continue
+		}
+		in := make(map[msId]float32)
+		calls := make([]crossCall, 0, len(caller.crossCalls))
+		for _, call := range caller.crossCalls {
+			if call.dmApp == app.id && isReplica(call.dmId) {
+				in[call.umId] += call.trans
+				continue
+			}
+			calls = append(calls, call)
+		}
+		for um, trans := range in {
+			for _, r := range replicas {
+				calls = append(calls, crossCall{umId: um, dmApp: app.id, dmId: r.id, trans: trans / float32(len(replicas))})
+			}
+		}
+		caller.crossCalls = calls
+	}
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScaleMicroservice(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	if err := mts.ScaleMicroservice(app.id, "B", 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range app.replicasOf("B") {
+		fmt.Printf("%s -> %s\n", r.id, r.placeNode)
+		if r.placeNode == NotPlaced || r.replicas != 3 {
+			t.Fatalf("expect replica %s to be placed", r.id)
+		}
+	}
+	if len(app.replicasOf("B")) != 3 || len(app.dep["A"]) != 4 || !approxEqual(app.dep["B#2"][0].trans, BandReq/3) {
+		t.Fatalf("expect the traffic of B to be split across 3 replicas")
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ScaleMicroservice(app.id, "B", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(app.replicasOf("B")) != 1 || app.ms["B"] == nil || len(app.dep["A"]) != 2 || !approxEqual(app.dep["B"][0].trans, BandReq) {
+		t.Fatalf("expect B to be scaled back to its first replica")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestScaleFailure(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	err := mts.ScaleMicroservice(app.id, "B", 20)
+	fmt.Println("scale B to 20 replicas:", err)
+	if err == nil || len(app.replicasOf("B")) != 1 || len(app.dep["A"]) != 2 || app.ms["B"].replicas > 1 {
+		t.Fatalf("expect the app to be unchanged after a failed scale-up")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestScaleCaller(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	auth, web := newTestShared(resReq, BandReq, BandReq)
+	mts := newTestMOTAS(cluster, auth, web)
+	placeApp(t, mts, "auth")
+	placeApp(t, mts, "web")
+
+	if err := mts.ScaleMicroservice("web", "B", 2); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("cross calls:", web.crossCalls)
+	if len(web.crossCalls) != 2 || !approxEqual(web.crossCalls[0].trans, BandReq/2) || len(web.remoteDep["B#1"]) != 1 {
+		t.Fatalf("expect the call to the shared service to be split across the replicas")
+	}
+	checkCommitted(t, mts)
+
+	if err := mts.ScaleMicroservice("auth", "S", 2); err == nil {
+		t.Fatalf("expect a pinned ms not to be scaled")
+	}
+}
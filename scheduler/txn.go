@@ -0,0 +1,165 @@
+package scheduler
+
+import "fmt"
+
+// txn 调度尝试的事务：预分配的节点资源、链路带宽和资源利用率以增量形式叠加在父事务之上，
+// 最外层事务叠加在已提交状态之上。提交时只把本事务的改动合并到父事务（或已提交状态），放弃时直接丢弃
+type txn struct {
+	parent *txn
+	alloc  map[*Node]map[ResourceType]float32 // node -> delta of allocated resources
+	gama   map[*Node]gamaPair                 // node -> gama after the reservations of this txn
+	band   map[*Link]float32                  // link -> delta of allocated bandwidth
+	group  map[*LinkGroup]float32             // link group -> delta of allocated bandwidth
+}
+
+// gamaPair 节点各类资源利用率的最大值和最小值
+type gamaPair struct {
+	max float32
+	min float32
+}
+
+func newTxn(parent *txn) *txn {
+	return &txn{
+		parent: parent,
+		alloc:  make(map[*Node]map[ResourceType]float32),
+		gama:   make(map[*Node]gamaPair),
+		band:   make(map[*Link]float32),
+		group:  make(map[*LinkGroup]float32),
+	}
+}
+
+// allocOf 节点在事务中的已分配资源，tx 为 nil 时返回已提交状态
+func (tx *txn) allocOf(node *Node, typ ResourceType) float32 {
+	v := node.alloc[typ].value
+	for t := tx; t != nil; t = t.parent {
+		v += t.alloc[node][typ]
+	}
+	return v
+}
+
+// gamaOf 节点在事务中的资源利用率最大值和最小值
+func (tx *txn) gamaOf(node *Node) (float32, float32) {
+	for t := tx; t != nil; t = t.parent {
+		if g, ok := t.gama[node]; ok {
+			return g.max, g.min
+		}
+	}
+	return node.maxGama, node.minGama
+}
+
+// bandOf 链路在事务中的已分配带宽
+func (tx *txn) bandOf(link *Link) float32 {
+	v := link.bandAlloc
+	for t := tx; t != nil; t = t.parent {
+		v += t.band[link]
+	}
+	return v
+}
+
+// groupOf 链路组在事务中的已分配带宽
+func (tx *txn) groupOf(g *LinkGroup) float32 {
+	v := g.bandAlloc
+	for t := tx; t != nil; t = t.parent {
+		v += t.group[g]
+	}
+	return v
+}
+
+func (tx *txn) addAlloc(node *Node, typ ResourceType, inc float32) {
+	if tx.alloc[node] == nil {
+		tx.alloc[node] = make(map[ResourceType]float32)
+	}
+	tx.alloc[node][typ] += inc
+}
+
+func (tx *txn) setGama(node *Node, maxGama, minGama float32) {
+	tx.gama[node] = gamaPair{max: maxGama, min: minGama}
+}
+
+func (tx *txn) addBand(link *Link, inc float32) {
+	tx.band[link] += inc
+}
+
+func (tx *txn) addGroup(g *LinkGroup, inc float32) {
+	tx.group[g] += inc
+}
+
+// commit 将事务的改动合并到父事务，没有父事务时写入已提交状态，提交后事务为空
+func (tx *txn) commit() {
+	if p := tx.parent; p != nil {
+		for node, deltas := range tx.alloc {
+			for typ, d := range deltas {
+				p.addAlloc(node, typ, d)
+			}
+		}
+		for node, g := range tx.gama {
+			p.gama[node] = g
+		}
+		for link, d := range tx.band {
+			p.band[link] += d
+		}
+		for g, d := range tx.group {
+			p.group[g] += d
+		}
+	} else {
+		for node, deltas := range tx.alloc {
+			for typ, d := range deltas {
+				node.alloc[typ].value += d
+			}
+		}
+		for node := range tx.gama { // 事务开启后可能有其他事务提交，按提交后的资源重新计算利用率
+			node.maxGama, node.minGama = node.gamaWith(func(typ ResourceType) float32 { return node.alloc[typ].value })
+		}
+		for link, d := range tx.band {
+			link.bandAlloc += d
+		}
+		for g, d := range tx.group {
+			g.bandAlloc += d
+		}
+	}
+	*tx = *newTxn(tx.parent)
+}
+
+// validate 检查事务中新增的预分配叠加在父事务（或已提交状态）当前的状态上是否仍不超过节点资源和链路带宽容量，
+// 事务开启后父事务或已提交状态发生变化时用于冲突检测
+func (tx *txn) validate() error {
+	for node, deltas := range tx.alloc {
+		for typ, d := range deltas {
+			if base := tx.parent.allocOf(node, typ); d > 0 && base+d > node.capa[typ].value {
+				return fmt.Errorf("conflict: node %s %v alloc/cap=%.2f/%.2f, request=%.2f",
+					node.id, typ, base, node.capa[typ].value, d)
+			}
+		}
+	}
+	for link, d := range tx.band {
+		if base := tx.parent.bandOf(link); d > 0 && base+d > link.bandCap {
+			return fmt.Errorf("conflict: link %s -> %s band alloc/cap=%.2f/%.2f, request=%.2f",
+				link.from, link.to, base, link.bandCap, d)
+		}
+	}
+	for g, d := range tx.group {
+		if base := tx.parent.groupOf(g); d > 0 && base+d > g.bandCap {
+			return fmt.Errorf("conflict: link group %s band alloc/cap=%.2f/%.2f, request=%.2f",
+				g.id, base, g.bandCap, d)
+		}
+	}
+	return nil
+}
+
+// begin 在集群（或分区）上开启一个事务，返回共享节点、链路和配置的事务视图，
+// 视图上的预分配只记录在事务中，视图本身已在事务中时开启子事务
+func (c *Cluster) begin() *Cluster {
+	return c.withTxn(newTxn(c.tx))
+}
+
+// withTxn 返回使用事务 tx 的集群视图
+func (c *Cluster) withTxn(tx *txn) *Cluster {
+	v := *c
+	v.tx = tx
+	return &v
+}
+
+// commit 提交视图的事务
+func (c *Cluster) commit() {
+	c.tx.commit()
+}
@@ -0,0 +1,68 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	tCluster := newTestCluster(DefaultResType, DefaultResCPU, DefaultResMem, DefaultBrand)
+	node0, link01 := tCluster.nodes["node0"], tCluster.links["node0"]["node1"]
+
+	attempt := tCluster.begin()
+	attempt.incNextAlloc("node0", ResCPU, 2)
+	attempt.incNextBandAlloc("node0", "node1", MB)
+
+	child := attempt.begin() // 子事务叠加在父事务之上
+	child.incNextAlloc("node0", ResCPU, 3)
+	child.updateNextGama("node0")
+	fmt.Println("child alloc:", child.nextAllocOf(node0, ResCPU), "attempt alloc:", attempt.nextAllocOf(node0, ResCPU))
+	if child.nextAllocOf(node0, ResCPU) != 5 || attempt.nextAllocOf(node0, ResCPU) != 2 {
+		t.Fatalf("expect the child txn to be layered on its parent")
+	}
+	child = attempt.begin() // 放弃子事务
+	if maxGama, _ := attempt.nextGamaOf(node0); maxGama != node0.maxGama {
+		t.Fatalf("expect an aborted child txn not to touch its parent")
+	}
+
+	other := tCluster.begin() // 另一次调度尝试只看到已提交状态
+	other.incNextAlloc("node1", ResCPU, 1)
+	if other.nextAllocOf(node0, ResCPU) != 0 || other.nextBandOf(link01) != 0 {
+		t.Fatalf("expect attempts to be isolated")
+	}
+
+	child.incNextBandAlloc("node0", "node1", MB)
+	child.commit()
+	if attempt.nextBandOf(link01) != 2*MB || link01.bandAlloc != 0 {
+		t.Fatalf("expect a child txn to be committed into its parent only")
+	}
+	attempt.commit()
+	fmt.Println("committed alloc:", node0.alloc[ResCPU].value, "band:", link01.bandAlloc)
+	if node0.alloc[ResCPU].value != 2 || link01.bandAlloc != 2*MB || tCluster.links["node1"]["node0"].bandAlloc != 2*MB {
+		t.Fatalf("expect the attempt to be committed")
+	}
+	if tCluster.nodes["node1"].alloc[ResCPU].value != 0 || other.nextAllocOf(tCluster.nodes["node1"], ResCPU) != 1 {
+		t.Fatalf("expect a commit to touch only the changes of its attempt")
+	}
+}
+
+func TestScheduleFailureKeepsState(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	huge := newTestService(map[ResourceType]Resource{ResCPU: {ResCPU, resCPU}, ResMem: {ResMem, 5 * MB}}, BandReq)
+	huge.id = "huge"
+	mts := newTestMOTAS(cluster, app, huge)
+
+	ms2node, err := mts.schedule(app.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mts.schedule(huge.id); err == nil {
+		t.Fatalf("expect app huge not to fit")
+	}
+	if huge.tx != nil {
+		t.Fatalf("expect the failed attempt to be aborted")
+	}
+	mts.doPlacement(app.id, ms2node)
+	checkCommitted(t, mts)
+}
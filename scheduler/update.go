@@ -0,0 +1,114 @@
+package scheduler
+
+import "fmt"
+
+// UpdateApp 按新的应用描述增量更新已放置的应用：只放置新增的微服务，按变化后的调用关系调整链路预留，
+// 删除的微服务和调用关系回收其资源和链路带宽，已有微服务保持原位置。allowMove 为 true 时，
+// 保持原位置无法放置的情况下允许移动已有微服务重新映射整个应用。更新失败时应用保持原状
+func (m *MOTAS) UpdateApp(spec *Service, allowMove bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.app[spec.id]
+	if !ok {
+		return fmt.Errorf("app %s not found", spec.id)
+	}
+	if !old.placed || old.members != nil {
+		return fmt.Errorf("app %s is not placed", spec.id)
+	}
+	if spec == old {
+		return fmt.Errorf("app %s is updated with its own description", spec.id)
+	}
+	spec.expandReplicas()
+
+	ms2node, err := m.tryUpdate(old, spec, true)
+	if err != nil && allowMove {
+		DLogINFO("app(id=%s) can not be updated in place (%v), moves the existing microservices", spec.id, err)
+		ms2node, err = m.tryUpdate(old, spec, false)
+	}
+	if err == nil { // 只检查更新带来的用量变化
+		usage := spec.byTenant(func(s *Service) *resUsage { return s.usageOf(m.cluster, true) })
+		if _, ok := usage[old.tenant]; !ok {
+			usage[old.tenant] = newResUsage()
+		}
+		if old.reserved != nil {
+			usage[old.tenant].add(old.reserved, -1)
+		}
+		err = m.checkTenants(usage)
+	}
+	if err != nil {
+		spec.rollbackPlaceStat()
+		m.app[spec.id] = old
+		DLogINFO("app(id=%s) update fails: %v", spec.id, err)
+		return err
+	}
+
+	m.unreserve(old)
+	m.doPlacement(spec.id, ms2node)
+	m.moveCrossCalls(spec)
+	DLogINFO("✅ app(id=%s) was updated successfully", spec.id)
+	return nil
+}
+
+// tryUpdate 在一个事务中回收旧应用占用的资源和链路带宽并映射新应用，keep 为 true 时已有微服务固定在原位置，
+// 成功时新应用替换旧应用登记，预分配记录在新应用的事务中等待提交，调用者需持有 m.mu
+func (m *MOTAS) tryUpdate(old, spec *Service, keep bool) (map[msId]nodeId, error) {
+	m.app[old.id] = old
+	c := m.cluster.begin()
+	m.releaseApp(c, old.id)
+	for _, call := range old.crossCalls {
+		c.decNextBandAlloc(call.from, call.to, call.trans)
+	}
+
+	kept := make([]*Microservice, 0, len(spec.ms))
+	for mid, ms := range spec.ms {
+		ms.placeNode, ms.nextPlaceNode = NotPlaced, NotPlaced
+		if prev, ok := old.ms[mid]; ok && keep && !ms.fixed() && prev.placeNode != NotPlaced {
+			ms.pinNode = prev.placeNode // 映射期间固定在原位置
+			kept = append(kept, ms)
+		}
+	}
+	m.app[spec.id] = spec
+	ms2node, err := m.scheduleOn(c, spec.id)
+	for _, ms := range kept {
+		ms.pinNode = ""
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 其他应用对本应用的跨应用调用：被调用的微服务删除时回收其链路带宽，移动时改为预留到新位置
+	for _, app := range m.app {
+		for _, call := range app.crossCalls {
+			if call.dmApp != spec.id {
+				continue
+			}
+			dm, ok := spec.ms[call.dmId]
+			if !ok || dm.nextPlaceNode != call.to {
+				c.decNextBandAlloc(call.from, call.to, call.trans)
+			}
+			if ok && dm.nextPlaceNode != call.to {
+				c.incNextBandAlloc(call.from, dm.nextPlaceNode, call.trans)
+			}
+		}
+	}
+	return ms2node, nil
+}
+
+// moveCrossCalls 应用更新后同步其他应用对本应用的跨应用调用记录，调用者需持有 m.mu
+func (m *MOTAS) moveCrossCalls(app *Service) {
+	for _, caller := range m.app {
+		kept := caller.crossCalls[:0]
+		for _, call := range caller.crossCalls {
+			if call.dmApp == app.id {
+				dm, ok := app.ms[call.dmId]
+				if !ok {
+					continue
+				}
+				call.to = dm.placeNode
+			}
+			kept = append(kept, call)
+		}
+		caller.crossCalls = kept
+	}
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestUpdateApp(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	// 新增 G（B -> G），删除 F（以及 C -> F），A -> B 的流量加倍
+	spec := newTestService(resReq, BandReq)
+	delete(spec.ms, "F")
+	spec.dep["C"] = spec.dep["C"][:1]
+	delete(spec.reDep, "F")
+	spec.dep["A"][0].trans = 2 * BandReq
+	spec.ms["G"] = &Microservice{id: "G", resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced}
+	g := &Dependence{umId: "B", dmId: "G", trans: BandReq}
+	spec.dep["B"] = append(spec.dep["B"], g)
+	spec.reDep["G"] = []*Dependence{g}
+
+	if err := mts.UpdateApp(spec, false); err != nil {
+		t.Fatal(err)
+	}
+	for mid, ms := range spec.ms {
+		fmt.Printf("%s -> %s\n", mid, ms.placeNode)
+		if prev, ok := app.ms[mid]; ok && prev.placeNode != ms.placeNode {
+			t.Fatalf("expect ms %s to stay on node %s, got %s", mid, prev.placeNode, ms.placeNode)
+		}
+	}
+	if mts.app[app.id] != spec || spec.ms["G"].placeNode == NotPlaced {
+		t.Fatalf("expect the new ms to be placed")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestUpdateAppMove(t *testing.T) {
+	cluster := newTestCluster(resType, 2*resCPU, 2*resMem, 4*brand)
+	app := newTestService(resReq, BandReq)
+	app.ms["A"].pinNode = "node0"
+	app.ms["B"].pinNode = "node0"
+	mts := newTestMOTAS(cluster, app)
+	placeApp(t, mts, app.id)
+
+	newSpec := func() *Service { // A 申请的 CPU 增加到原节点无法容纳
+		spec := newTestService(resReq, BandReq)
+		spec.ms["A"].resReq = map[ResourceType]Resource{ResCPU: {ResCPU, 2*resCPU - 1}, ResMem: {ResMem, 2*resMem - 25*MB}}
+		return spec
+	}
+	app.ms["A"].pinNode, app.ms["B"].pinNode = "", ""
+	placed := app.ms["A"].placeNode
+	fmt.Println("A is placed on", placed)
+
+	err := mts.UpdateApp(newSpec(), false)
+	fmt.Println("update in place:", err)
+	if err == nil || mts.app[app.id] != app || app.ms["A"].placeNode != placed {
+		t.Fatalf("expect the update to fail without moving and leave the app unchanged")
+	}
+	checkCommitted(t, mts)
+
+	spec := newSpec()
+	if err := mts.UpdateApp(spec, true); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("A is moved to", spec.ms["A"].placeNode)
+	if mts.app[app.id] != spec || spec.ms["A"].placeNode == NotPlaced {
+		t.Fatalf("expect the app to be updated by moving the existing ms")
+	}
+	checkCommitted(t, mts)
+}
+
+func TestUpdateCallee(t *testing.T) {
+	cluster := newTestCluster(resType, resCPU, resMem, 4*brand)
+	auth, web := newTestShared(resReq, BandReq, BandReq)
+	mts := newTestMOTAS(cluster, auth, web)
+	placeApp(t, mts, "auth")
+	placeApp(t, mts, "web")
+
+	spec, _ := newTestShared(resReq, BandReq, BandReq)
+	spec.ms["T"] = &Microservice{id: "T", resReq: resReq, placeNode: NotPlaced, nextPlaceNode: NotPlaced}
+	delete(spec.ms, "S")
+	spec.rootId = "T"
+	if err := mts.UpdateApp(spec, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.crossCalls) != 0 {
+		t.Fatalf("expect the call to the deleted ms to be dropped, got %v", web.crossCalls)
+	}
+	checkCommitted(t, mts)
+}
@@ -1,10 +1,14 @@
 package util
 
-import "container/heap"
+import (
+	"container/heap"
+	"time"
+)
 
-// PriorityQueue 对内部实现的优先级队列进行包装
+// PriorityQueue 对内部实现的优先级队列进行包装，优先级相同时按入队时间（未指定时按 push 顺序）先后出队
 type PriorityQueue struct {
-	q priorityQueue
+	q   priorityQueue
+	seq uint64 // number of pushed entries, used to keep FIFO order among equal priorities
 }
 
 func NewPriorityQueue(length int) *PriorityQueue {
@@ -14,6 +18,8 @@ func NewPriorityQueue(length int) *PriorityQueue {
 }
 
 func (pq *PriorityQueue) Push(x interface{}) {
+	pq.seq++
+	x.(*entry).seq = pq.seq
 	heap.Push(&pq.q, x)
 }
 
@@ -25,12 +31,18 @@ func (pq *PriorityQueue) Empty() bool {
 	return pq.q.empty()
 }
 
+func (pq *PriorityQueue) Len() int {
+	return pq.q.Len()
+}
+
 // priorityQueue 优先级队列内部实现
 type priorityQueue []*entry
 
 type entry struct {
 	item     interface{}
 	priority float32
+	at       int64  // enqueue time in nanoseconds, 0 if not given
+	seq      uint64 // push order
 }
 
 func (q priorityQueue) Len() int {
@@ -38,7 +50,13 @@ func (q priorityQueue) Len() int {
 }
 
 func (q priorityQueue) Less(i, j int) bool {
-	return q[i].priority > q[j].priority // 优先级越大越靠近队首
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority // 优先级越大越靠近队首
+	}
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at // 优先级相同时入队时间早者靠近队首
+	}
+	return q[i].seq < q[j].seq // 入队时间也相同时先 push 者靠近队首
 }
 
 func (q priorityQueue) Swap(i, j int) {
@@ -74,6 +92,16 @@ func NewEntry(item interface{}, priority float32) *entry {
 	}
 }
 
+// NewEntryAt 创建带入队时间的优先级队列元素，优先级相同时按入队时间先后出队，
+// 元素重新 push 时保留原入队时间即可保持原来的先后顺序
+func NewEntryAt(item interface{}, priority float32, at time.Time) *entry {
+	return &entry{
+		item:     item,
+		priority: priority,
+		at:       at.UnixNano(),
+	}
+}
+
 // ExtractItemFromEntry 暴露从 Entry 中获取 Iterm 的接口
 func ExtractItemFromEntry(e interface{}) interface{} {
 	return e.(*entry).item
@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 type fruit struct {
@@ -33,3 +34,37 @@ func TestPriorityQueue(t *testing.T) {
 		// apple 2
 	}
 }
+
+func TestPriorityQueueFIFO(t *testing.T) {
+	q := NewPriorityQueue(5)
+	names := []string{"apple", "orange", "banana", "pear", "grape"}
+	for _, name := range names {
+		q.Push(NewEntry(name, 1))
+	}
+	q.Push(NewEntry("melon", 2))
+
+	if name := ExtractItemFromEntry(q.Pop()).(string); name != "melon" {
+		t.Fatalf("expect melon at the head, got %s", name)
+	}
+	for _, want := range names {
+		got := ExtractItemFromEntry(q.Pop()).(string)
+		fmt.Println(got)
+		if got != want {
+			t.Fatalf("expect %s, got %s", want, got)
+		}
+	}
+}
+
+func TestPriorityQueueEnqueueTime(t *testing.T) {
+	q := NewPriorityQueue(5)
+	now := time.Now()
+	q.Push(NewEntryAt("orange", 1, now.Add(time.Second)))
+	q.Push(NewEntryAt("apple", 1, now)) // 入队更早，后 push 仍先出队
+	q.Push(NewEntryAt("pear", 1, now.Add(time.Second)))
+
+	for _, want := range []string{"apple", "orange", "pear"} {
+		if got := ExtractItemFromEntry(q.Pop()).(string); got != want {
+			t.Fatalf("expect %s, got %s", want, got)
+		}
+	}
+}